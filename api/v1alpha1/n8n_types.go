@@ -17,7 +17,11 @@ limitations under the License.
 package v1alpha1
 
 import (
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -53,6 +57,83 @@ type Database struct {
 	Postgres Postgres `json:"postgres"`
 }
 
+// RouteTermination is where an OpenShift Route terminates TLS
+// +kubebuilder:validation:Enum=edge;reencrypt;passthrough
+type RouteTermination string
+
+const (
+	// RouteTerminationEdge terminates TLS at the router
+	RouteTerminationEdge RouteTermination = "edge"
+	// RouteTerminationReencrypt terminates TLS at the router and opens a new TLS connection to n8n
+	RouteTerminationReencrypt RouteTermination = "reencrypt"
+	// RouteTerminationPassthrough passes the TLS connection through to n8n
+	RouteTerminationPassthrough RouteTermination = "passthrough"
+)
+
+// RouteConfig defines the OpenShift Route exposing n8n
+type RouteConfig struct {
+	// Enable indicates whether to create a Route
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// Annotations added to the Route, e.g. router timeouts
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Labels added to the Route, e.g. to select a router shard
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Labels map[string]string `json:"labels,omitempty"`
+	// TLS configuration of the Route, plain HTTP when unset
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	TLS *RouteTLS `json:"tls,omitempty"`
+}
+
+// RouteTLS defines how an OpenShift Route secures the connection
+// +kubebuilder:validation:XValidation:rule="self.termination == 'passthrough' || !has(self.servingCertSecret)",message="servingCertSecret requires passthrough termination"
+// +kubebuilder:validation:XValidation:rule="self.termination != 'passthrough' || !has(self.insecureEdgeTerminationPolicy) || self.insecureEdgeTerminationPolicy != 'Allow'",message="passthrough termination cannot allow insecure traffic"
+type RouteTLS struct {
+	// Termination is where TLS is terminated, reencrypt and passthrough make n8n serve TLS itself
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=edge
+	Termination RouteTermination `json:"termination,omitempty"`
+	// InsecureEdgeTerminationPolicy decides what happens to plain HTTP requests
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Enum=None;Allow;Redirect
+	// +kubebuilder:default=Redirect
+	InsecureEdgeTerminationPolicy string `json:"insecureEdgeTerminationPolicy,omitempty"`
+	// ServingCertSecret is a kubernetes.io/tls Secret n8n serves with passthrough termination,
+	// the OpenShift service CA issues the certificate when unset
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ServingCertSecret string `json:"servingCertSecret,omitempty"`
+}
+
+// ServiceConfig defines how the n8n Service is exposed
+// +kubebuilder:validation:XValidation:rule="!has(self.loadBalancerSourceRanges) || (has(self.type) && self.type == 'LoadBalancer')",message="loadBalancerSourceRanges requires type LoadBalancer"
+// +kubebuilder:validation:XValidation:rule="!has(self.externalTrafficPolicy) || (has(self.type) && self.type != 'ClusterIP')",message="externalTrafficPolicy requires type NodePort or LoadBalancer"
+type ServiceConfig struct {
+	// Type of the Service
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +kubebuilder:default=ClusterIP
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// Port the Service exposes n8n on
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default=80
+	Port int32 `json:"port,omitempty"`
+	// Annotations added to the Service, e.g. to configure a cloud load balancer
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// LoadBalancerSourceRanges restricts the clients allowed through the load balancer
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:items:XValidation:rule="isCIDR(self)",message="must be a CIDR"
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+	// ExternalTrafficPolicy of the Service, Local preserves the client source IP
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Enum=Cluster;Local
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicy `json:"externalTrafficPolicy,omitempty"`
+}
+
 // IngressConfig defines the configuration for Kubernetes Ingress
 type IngressConfig struct {
 	// Enable indicates whether to create an Ingress resource
@@ -65,6 +146,24 @@ type IngressConfig struct {
 	// TLS configuration for the Ingress
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	TLS []IngressTLS `json:"tls,omitempty"`
+	// Annotations added to the Ingress, e.g. for ingress controller or external-dns settings
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Labels added to the Ingress
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Labels map[string]string `json:"labels,omitempty"`
+	// Hosts are additional hostnames routed to the editor next to the primary hostname
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Hosts []string `json:"hosts,omitempty"`
+	// Path routed to the editor, defaults to the hostname path or "/". n8n is served under the hostname path,
+	// so the path must match it; implementation specific paths, e.g. regular expressions, must start with it.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Path string `json:"path,omitempty"`
+	// PathType of the Ingress paths
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Enum=Exact;Prefix;ImplementationSpecific
+	// +kubebuilder:default=Prefix
+	PathType string `json:"pathType,omitempty"`
 }
 
 // IngressTLS defines TLS configuration for Ingress
@@ -75,6 +174,33 @@ type IngressTLS struct {
 	// SecretName is the name of the secret containing TLS credentials
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	SecretName string `json:"secretName,omitempty"`
+	// CertManager issues the certificate into SecretName instead of expecting the Secret to exist
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	CertManager *CertManagerConfig `json:"certManager,omitempty"`
+}
+
+// CertManagerConfig references the cert-manager issuer signing the certificate
+// +kubebuilder:validation:XValidation:rule="has(self.issuer) != has(self.clusterIssuer)",message="exactly one of issuer and clusterIssuer is required"
+type CertManagerConfig struct {
+	// Issuer is the name of an Issuer in the namespace of the N8n resource
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Issuer string `json:"issuer,omitempty"`
+	// ClusterIssuer is the name of a ClusterIssuer
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ClusterIssuer string `json:"clusterIssuer,omitempty"`
+}
+
+// HTTPRouteTLS defines the certificate requested for the hostnames of the HTTPRoute
+type HTTPRouteTLS struct {
+	// SecretName is the Secret the certificate is stored in, for the Gateway listener to reference
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+	// CertManager issues the certificate
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	CertManager CertManagerConfig `json:"certManager"`
 }
 
 // HTTPRouteConfig defines the configuration for Gateway API HTTPRoute
@@ -87,6 +213,21 @@ type HTTPRouteConfig struct {
 	// GatewayRef is the name of the Gateway to attach to
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	GatewayRef GatewayRef `json:"gatewayRef,omitempty"`
+	// TLS requests a certificate for the hostnames from cert-manager
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	TLS *HTTPRouteTLS `json:"tls,omitempty"`
+	// AdditionalGatewayRefs are further Gateways or listeners the HTTPRoute attaches to
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	AdditionalGatewayRefs []GatewayRef `json:"additionalGatewayRefs,omitempty"`
+	// RequestHeaderModifier modifies the headers of requests sent to n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	RequestHeaderModifier *gatewayv1.HTTPHeaderFilter `json:"requestHeaderModifier,omitempty"`
+	// ResponseHeaderModifier modifies the headers of responses returned by n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ResponseHeaderModifier *gatewayv1.HTTPHeaderFilter `json:"responseHeaderModifier,omitempty"`
+	// Timeouts of the requests to n8n, e.g. to let long-running webhooks finish
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Timeouts *gatewayv1.HTTPRouteTimeouts `json:"timeouts,omitempty"`
 }
 
 // GatewayRef defines the reference to a Gateway
@@ -98,9 +239,57 @@ type GatewayRef struct {
 	// Namespace of the gateway
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	Namespace string `json:"namespace,omitempty"`
+	// SectionName is the name of the listener to attach to
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	SectionName string `json:"sectionName,omitempty"`
+	// Port of the listeners to attach to
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port *int32 `json:"port,omitempty"`
+}
+
+// RoutingConfig splits the editor UI and the public webhook endpoint onto separate hostnames
+type RoutingConfig struct {
+	// Editor is where the editor UI and the REST API are served
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Editor EndpointConfig `json:"editor"`
+	// Webhook is where the production and test webhooks are served
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Webhook WebhookEndpointConfig `json:"webhook"`
+}
+
+// EndpointConfig defines how an n8n endpoint is exposed
+type EndpointConfig struct {
+	// Hostname the endpoint is served on
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	Hostname string `json:"hostname"`
+	// IngressClassName overrides spec.ingress.ingressClassName for this endpoint, e.g. to keep it internal
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	IngressClassName string `json:"ingressClassName,omitempty"`
+	// GatewayRef overrides spec.httpRoute.gatewayRef for this endpoint
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	GatewayRef *GatewayRef `json:"gatewayRef,omitempty"`
+}
+
+// WebhookEndpointConfig defines how the webhook endpoint is exposed
+type WebhookEndpointConfig struct {
+	EndpointConfig `json:",inline"`
+	// Paths are the path prefixes routed to the webhook endpoint
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default={"/webhook","/webhook-test","/webhook-waiting"}
+	// +kubebuilder:validation:MinItems=1
+	Paths []string `json:"paths,omitempty"`
 }
 
 // PersistentStorageConfig defines the configuration for persistent storage
+// +kubebuilder:validation:XValidation:rule="!has(self.existingClaim) || !has(self.volumeSource)",message="existingClaim and volumeSource are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="!has(self.size) || isQuantity(self.size)",message="size must be a quantity, e.g. 10Gi"
+// +kubebuilder:validation:XValidation:rule="!has(oldSelf.size) || !has(self.size) || !isQuantity(oldSelf.size) || !isQuantity(self.size) || quantity(self.size).compareTo(quantity(oldSelf.size)) >= 0",message="size can't be decreased"
 type PersistentStorageConfig struct {
 	// Enable indicates whether to create a PVC for n8n data
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
@@ -113,13 +302,143 @@ type PersistentStorageConfig struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// +kubebuilder:default="10Gi"
 	Size string `json:"size,omitempty"`
+	// AccessModes of the volume, defaults to ReadWriteOnce. ReadWriteMany lets several n8n pods share the filesystem.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+	// VolumeMode of the volume
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	VolumeMode *corev1.PersistentVolumeMode `json:"volumeMode,omitempty"`
+	// Selector restricts the PersistentVolumes the claim can bind to
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Labels added to the PVC
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations added to the PVC
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ExistingClaim is a PVC to mount instead of creating one. The operator doesn't manage or delete it.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ExistingClaim string `json:"existingClaim,omitempty"`
+	// VolumeSource to mount instead of creating a PVC
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	VolumeSource *corev1.VolumeSource `json:"volumeSource,omitempty"`
+}
+
+// StorageConfig defines how the operator prepares the n8n data volume
+type StorageConfig struct {
+	// FixPermissions runs an init container as root changing the ownership of the data volume to the n8n user.
+	// Only volumes ignoring fsGroup need it, and pods running it don't pass the restricted Pod Security Standard.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	FixPermissions bool `json:"fixPermissions,omitempty"`
+	// Image of the init container fixing the permissions
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default="busybox:1.37.0"
+	Image string `json:"image,omitempty"`
+}
+
+// SecurityConfig defines the security contexts of the pods the operator creates
+type SecurityConfig struct {
+	// OpenShift omits the fixed user and group IDs from the default security contexts so the
+	// restricted SecurityContextConstraints can assign them
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	OpenShift bool `json:"openShift,omitempty"`
+	// ReadOnlyRootFilesystem mounts the container root filesystems read-only, with emptyDir volumes
+	// for the paths n8n writes to
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem,omitempty"`
+	// PodSecurityContext replaces the default pod security context
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// ContainerSecurityContext replaces the default container security context
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+}
+
+// NetworkPolicyConfig defines the NetworkPolicy restricting the traffic of the n8n pods
+type NetworkPolicyConfig struct {
+	// Enable indicates whether to create a NetworkPolicy
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// IngressNamespaces are the namespaces of the ingress controller or Gateway allowed to reach n8n.
+	// The namespace of the Gateway referenced by the HTTPRoute is always allowed.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	IngressNamespaces []string `json:"ingressNamespaces,omitempty"`
+	// MonitoringNamespaces are the namespaces Prometheus scrapes the metrics from
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MonitoringNamespaces []string `json:"monitoringNamespaces,omitempty"`
+	// DefaultDeny restricts egress as well, to DNS, the database, Redis and EgressCIDRs
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	DefaultDeny bool `json:"defaultDeny,omitempty"`
+	// EgressCIDRs n8n may connect to when DefaultDeny is set, e.g. for SMTP or the APIs workflows call
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:items:XValidation:rule="isCIDR(self)",message="must be a CIDR, e.g. 10.0.0.0/8"
+	EgressCIDRs []string `json:"egressCIDRs,omitempty"`
 }
 
 // Metrics defines the configuration for metrics
+// +kubebuilder:validation:XValidation:rule="!(has(self.serviceMonitor) && has(self.podMonitor))",message="serviceMonitor and podMonitor are mutually exclusive"
 type MetricsConfig struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// +kubebuilder:validation:Required
 	Enable bool `json:"enable"`
+	// ServiceMonitor configures the ServiceMonitor scraping n8n through its Service, the default
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ServiceMonitor *MonitorConfig `json:"serviceMonitor,omitempty"`
+	// PodMonitor scrapes every n8n pod directly instead of a ServiceMonitor
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	PodMonitor *MonitorConfig `json:"podMonitor,omitempty"`
+	// Include enables optional metrics and labels
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Include *MetricsIncludeConfig `json:"include,omitempty"`
+}
+
+// MonitorConfig defines how Prometheus scrapes n8n
+type MonitorConfig struct {
+	// Interval between scrapes, the Prometheus default when unset
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Interval monitoringv1.Duration `json:"interval,omitempty"`
+	// ScrapeTimeout of a scrape, the Prometheus default when unset
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ScrapeTimeout monitoringv1.Duration `json:"scrapeTimeout,omitempty"`
+	// Labels added to the monitor, e.g. to match the selector of a Prometheus
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Labels map[string]string `json:"labels,omitempty"`
+	// Relabelings applied to the targets before scraping
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Relabelings []monitoringv1.RelabelConfig `json:"relabelings,omitempty"`
+	// MetricRelabelings applied to the scraped samples
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MetricRelabelings []monitoringv1.RelabelConfig `json:"metricRelabelings,omitempty"`
+	// TLSConfig to scrape n8n over HTTPS
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	TLSConfig *monitoringv1.SafeTLSConfig `json:"tlsConfig,omitempty"`
+}
+
+// MetricsIncludeConfig enables optional n8n metrics and labels
+type MetricsIncludeConfig struct {
+	// WorkflowIDLabel labels workflow metrics with the workflow ID
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	WorkflowIDLabel bool `json:"workflowIdLabel,omitempty"`
+	// NodeTypeLabel labels node metrics with the node type
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	NodeTypeLabel bool `json:"nodeTypeLabel,omitempty"`
+	// CredentialTypeLabel labels credential metrics with the credential type
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	CredentialTypeLabel bool `json:"credentialTypeLabel,omitempty"`
+	// APIEndpoints exposes metrics of the API endpoints
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	APIEndpoints bool `json:"apiEndpoints,omitempty"`
+	// CacheMetrics exposes cache hits and misses
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	CacheMetrics bool `json:"cacheMetrics,omitempty"`
+	// MessageEventBusMetrics exposes the events of the message event bus
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MessageEventBusMetrics bool `json:"messageEventBusMetrics,omitempty"`
+	// QueueMetrics exposes the job counts of queue mode
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	QueueMetrics bool `json:"queueMetrics,omitempty"`
 }
 
 // +kubebuilder:validation:XValidation:rule="!self.enable || has(self.url)",message="url is required when enable is true"
@@ -132,9 +451,538 @@ type HostnameConfig struct {
 	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
 	// +kubebuilder:validation:MinLength=1
 	Url string `json:"url,omitempty"`
+
+	// Path is the sub-path n8n is served under (e.g., "/n8n/"), defaults to "/"
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Pattern=`^/([A-Za-z0-9._~-]+/?)*$`
+	Path string `json:"path,omitempty"`
+}
+
+// SMTPConfig defines the configuration for sending user management emails over SMTP
+// +kubebuilder:validation:XValidation:rule="!self.enable || (has(self.host) && has(self.sender))",message="host and sender are required when enable is true"
+// +kubebuilder:validation:XValidation:rule="!(has(self.ssl) && self.ssl && has(self.startTLS) && self.startTLS)",message="ssl and startTLS cannot both be enabled"
+type SMTPConfig struct {
+	// Enable indicates whether n8n should send emails over SMTP
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// Host is the hostname of the SMTP server
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host,omitempty"`
+	// Port is the port of the SMTP server; the default is the submission port used with STARTTLS
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default=587
+	Port int32 `json:"port,omitempty"`
+	// Sender is the address emails are sent from (e.g., "n8n <n8n@example.com>")
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:MinLength=1
+	Sender string `json:"sender,omitempty"`
+	// SSL indicates whether to connect to the SMTP server over implicit TLS
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	SSL bool `json:"ssl,omitempty"`
+	// StartTLS indicates whether to upgrade the connection with STARTTLS; n8n enables it when unset
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	StartTLS *bool `json:"startTLS,omitempty"`
+	// CredentialsSecret references the Secret holding the SMTP user and password
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	CredentialsSecret *SMTPCredentialsSecret `json:"credentialsSecret,omitempty"`
+}
+
+// SMTPCredentialsSecret defines the Secret holding SMTP credentials
+type SMTPCredentialsSecret struct {
+	// Name of the Secret in the namespace of the N8n resource
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// UserKey is the key in the Secret holding the SMTP user
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=username
+	UserKey string `json:"userKey,omitempty"`
+	// PasswordKey is the key in the Secret holding the SMTP password
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=password
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// BinaryDataMode is the storage backend n8n uses for binary data
+// +kubebuilder:validation:Enum=filesystem;s3
+type BinaryDataMode string
+
+const (
+	// BinaryDataModeFilesystem stores binary data under the n8n user folder
+	BinaryDataModeFilesystem BinaryDataMode = "filesystem"
+	// BinaryDataModeS3 stores binary data in S3-compatible object storage
+	BinaryDataModeS3 BinaryDataMode = "s3"
+)
+
+// BinaryDataConfig defines the configuration for n8n binary data storage
+// +kubebuilder:validation:XValidation:rule="self.mode != 's3' || has(self.s3)",message="s3 is required when mode is s3"
+type BinaryDataConfig struct {
+	// Mode is the storage backend for binary data
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=filesystem
+	Mode BinaryDataMode `json:"mode,omitempty"`
+	// S3 configuration used when mode is s3
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	S3 *S3Config `json:"s3,omitempty"`
+}
+
+// S3Config defines the S3-compatible object storage for binary data
+type S3Config struct {
+	// Endpoint is the host of the S3 API (e.g., "s3.us-east-1.amazonaws.com")
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+	// Bucket is the name of the bucket
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+	// Region is the region of the bucket
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Region string `json:"region,omitempty"`
+	// CredentialsSecret references the Secret holding the access key; when unset,
+	// credentials are auto-detected from the pod environment (e.g., IRSA)
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	CredentialsSecret *AWSCredentialsSecret `json:"credentialsSecret,omitempty"`
+}
+
+// AWSCredentialsSecret defines the Secret holding an AWS-style access key
+type AWSCredentialsSecret struct {
+	// Name of the Secret in the namespace of the N8n resource
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// AccessKeyIDKey is the key in the Secret holding the access key ID
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=accessKeyId
+	AccessKeyIDKey string `json:"accessKeyIdKey,omitempty"`
+	// SecretAccessKeyKey is the key in the Secret holding the secret access key
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=secretAccessKey
+	SecretAccessKeyKey string `json:"secretAccessKeyKey,omitempty"`
+}
+
+// SecretKeyRef selects a key of a Secret in the namespace of the N8n resource
+type SecretKeyRef struct {
+	// Name of the Secret
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Key within the Secret
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
+// ExternalSecretsProvider is an external secrets store supported by n8n
+// +kubebuilder:validation:Enum=vault;awsSecretsManager;infisical
+type ExternalSecretsProvider string
+
+const (
+	// ExternalSecretsProviderVault is HashiCorp Vault
+	ExternalSecretsProviderVault ExternalSecretsProvider = "vault"
+	// ExternalSecretsProviderAWSSecretsManager is AWS Secrets Manager
+	ExternalSecretsProviderAWSSecretsManager ExternalSecretsProvider = "awsSecretsManager"
+	// ExternalSecretsProviderInfisical is Infisical
+	ExternalSecretsProviderInfisical ExternalSecretsProvider = "infisical"
+)
+
+// ExternalSecretsConfig defines the configuration for n8n external secrets
+// +kubebuilder:validation:XValidation:rule="!self.enable || has(self.provider)",message="provider is required when enable is true"
+// +kubebuilder:validation:XValidation:rule="!has(self.provider) || self.provider != 'vault' || has(self.vault)",message="vault is required when provider is vault"
+// +kubebuilder:validation:XValidation:rule="!has(self.provider) || self.provider != 'awsSecretsManager' || has(self.awsSecretsManager)",message="awsSecretsManager is required when provider is awsSecretsManager"
+// +kubebuilder:validation:XValidation:rule="!has(self.provider) || self.provider != 'infisical' || has(self.infisical)",message="infisical is required when provider is infisical"
+type ExternalSecretsConfig struct {
+	// Enable indicates whether to wire an external secrets provider into n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// Provider is the external secrets store to use
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Provider ExternalSecretsProvider `json:"provider,omitempty"`
+	// UpdateInterval is how often n8n refreshes secrets from the provider, in seconds
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=300
+	UpdateInterval int32 `json:"updateInterval,omitempty"`
+	// Vault configuration used when provider is vault
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Vault *VaultConfig `json:"vault,omitempty"`
+	// AWSSecretsManager configuration used when provider is awsSecretsManager
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	AWSSecretsManager *AWSSecretsManagerConfig `json:"awsSecretsManager,omitempty"`
+	// Infisical configuration used when provider is infisical
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Infisical *InfisicalConfig `json:"infisical,omitempty"`
+}
+
+// VaultConfig defines the connection to HashiCorp Vault
+type VaultConfig struct {
+	// URL of the Vault server (e.g., "https://vault.example.com:8200")
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+	// Namespace is the Vault enterprise namespace
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Namespace string `json:"namespace,omitempty"`
+	// TokenSecret references the Vault token
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	TokenSecret SecretKeyRef `json:"tokenSecret"`
+	// CACertSecret references a CA certificate used to verify the Vault server
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	CACertSecret *SecretKeyRef `json:"caCertSecret,omitempty"`
+}
+
+// AWSSecretsManagerConfig defines the connection to AWS Secrets Manager
+type AWSSecretsManagerConfig struct {
+	// Region of the secrets
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Region string `json:"region"`
+	// CredentialsSecret references the Secret holding the access key; when unset,
+	// credentials are auto-detected from the pod environment (e.g., IRSA)
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	CredentialsSecret *AWSCredentialsSecret `json:"credentialsSecret,omitempty"`
+}
+
+// InfisicalConfig defines the connection to Infisical
+type InfisicalConfig struct {
+	// SiteURL is the URL of the Infisical instance
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default="https://app.infisical.com"
+	SiteURL string `json:"siteURL,omitempty"`
+	// TokenSecret references the Infisical service token
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	TokenSecret SecretKeyRef `json:"tokenSecret"`
+}
+
+// LicenseConfig defines the configuration for n8n enterprise license activation
+// +kubebuilder:validation:XValidation:rule="!self.enable || has(self.activationKeySecret)",message="activationKeySecret is required when enable is true"
+type LicenseConfig struct {
+	// Enable indicates whether to activate an n8n enterprise license
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// ActivationKeySecret references the license activation key
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ActivationKeySecret *SecretKeyRef `json:"activationKeySecret,omitempty"`
+	// ServerURL overrides the URL of the n8n license server
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ServerURL string `json:"serverURL,omitempty"`
+	// AutoRenew indicates whether n8n renews the license automatically
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=true
+	AutoRenew *bool `json:"autoRenew,omitempty"`
+}
+
+// ConfigMapKeyRef selects a key of a ConfigMap in the namespace of the N8n resource
+type ConfigMapKeyRef struct {
+	// Name of the ConfigMap
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Key within the ConfigMap
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
+// AuthConfig defines the identity provider integration of n8n
+// +kubebuilder:validation:XValidation:rule="[has(self.saml) && self.saml.enable, has(self.oidc) && self.oidc.enable, has(self.ldap) && self.ldap.enable].filter(x, x).size() <= 1",message="only one of saml, oidc and ldap can be enabled"
+// +kubebuilder:validation:XValidation:rule="!(has(self.saml) || has(self.oidc) || has(self.ldap)) || has(self.adminCredentialsSecret)",message="adminCredentialsSecret is required to configure saml, oidc or ldap"
+type AuthConfig struct {
+	// AdminCredentialsSecret references the credentials of an n8n owner account used by the
+	// operator to apply the identity provider and external secrets settings through the n8n API.
+	// The operator sets up the owner account with them while n8n has none.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	AdminCredentialsSecret *AdminCredentialsSecret `json:"adminCredentialsSecret,omitempty"`
+	// JustInTimeProvisioning indicates whether SSO users are created on their first login
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	JustInTimeProvisioning *bool `json:"justInTimeProvisioning,omitempty"`
+	// RedirectLoginToSSO indicates whether the login page redirects straight to the identity provider
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	RedirectLoginToSSO *bool `json:"redirectLoginToSSO,omitempty"`
+	// SAML configuration
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	SAML *SAMLConfig `json:"saml,omitempty"`
+	// OIDC configuration
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	OIDC *OIDCConfig `json:"oidc,omitempty"`
+	// LDAP configuration
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	LDAP *LDAPConfig `json:"ldap,omitempty"`
+}
+
+// AdminCredentialsSecret defines the Secret holding the credentials of an n8n owner account
+type AdminCredentialsSecret struct {
+	// Name of the Secret in the namespace of the N8n resource
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// EmailKey is the key in the Secret holding the account email
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=email
+	EmailKey string `json:"emailKey,omitempty"`
+	// PasswordKey is the key in the Secret holding the account password
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=password
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// SAMLConfig defines the SAML identity provider
+// +kubebuilder:validation:XValidation:rule="!self.enable || has(self.metadataConfigMap) || has(self.metadataURL)",message="metadataConfigMap or metadataURL is required when enable is true"
+type SAMLConfig struct {
+	// Enable indicates whether users can log in with SAML
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// MetadataConfigMap references the identity provider metadata XML
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MetadataConfigMap *ConfigMapKeyRef `json:"metadataConfigMap,omitempty"`
+	// MetadataURL is the URL of the identity provider metadata
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MetadataURL string `json:"metadataURL,omitempty"`
+}
+
+// OIDCConfig defines the OpenID Connect identity provider
+// +kubebuilder:validation:XValidation:rule="!self.enable || (has(self.discoveryEndpoint) && has(self.clientID) && has(self.clientSecret))",message="discoveryEndpoint, clientID and clientSecret are required when enable is true"
+type OIDCConfig struct {
+	// Enable indicates whether users can log in with OIDC
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// DiscoveryEndpoint is the OpenID Connect discovery URL of the identity provider
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	DiscoveryEndpoint string `json:"discoveryEndpoint,omitempty"`
+	// ClientID is the OAuth client ID registered for n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ClientID string `json:"clientID,omitempty"`
+	// ClientSecret references the OAuth client secret
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ClientSecret *SecretKeyRef `json:"clientSecret,omitempty"`
+}
+
+// LDAPConfig defines the LDAP server used for logging in
+// +kubebuilder:validation:XValidation:rule="!self.enable || (has(self.host) && has(self.baseDN))",message="host and baseDN are required when enable is true"
+type LDAPConfig struct {
+	// Enable indicates whether users can log in with LDAP
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// Host is the hostname of the LDAP server
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Host string `json:"host,omitempty"`
+	// Port is the port of the LDAP server
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default=389
+	Port int32 `json:"port,omitempty"`
+	// ConnectionSecurity is the transport security of the connection
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Enum=none;tls;startTls
+	// +kubebuilder:default=none
+	ConnectionSecurity string `json:"connectionSecurity,omitempty"`
+	// AllowUnauthorizedCerts indicates whether to skip verification of the server certificate
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	AllowUnauthorizedCerts bool `json:"allowUnauthorizedCerts,omitempty"`
+	// BaseDN is the distinguished name users are searched under
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	BaseDN string `json:"baseDN,omitempty"`
+	// BindDN is the distinguished name used to bind to the server
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	BindDN string `json:"bindDN,omitempty"`
+	// BindPasswordSecret references the password of BindDN
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	BindPasswordSecret *SecretKeyRef `json:"bindPasswordSecret,omitempty"`
+	// UserFilter is an additional LDAP filter applied when searching users
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	UserFilter string `json:"userFilter,omitempty"`
+	// LoginIDAttribute is the attribute users log in with
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=mail
+	LoginIDAttribute string `json:"loginIDAttribute,omitempty"`
+	// EmailAttribute is the attribute holding the user email
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=mail
+	EmailAttribute string `json:"emailAttribute,omitempty"`
+	// FirstNameAttribute is the attribute holding the user first name
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=givenName
+	FirstNameAttribute string `json:"firstNameAttribute,omitempty"`
+	// LastNameAttribute is the attribute holding the user last name
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=sn
+	LastNameAttribute string `json:"lastNameAttribute,omitempty"`
+	// IDAttribute is the attribute uniquely identifying a user
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=uid
+	IDAttribute string `json:"idAttribute,omitempty"`
+	// SynchronizationInterval is the interval in minutes between user synchronizations; zero disables synchronization
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=0
+	SynchronizationInterval int32 `json:"synchronizationInterval,omitempty"`
+}
+
+// AutoscalingConfig defines horizontal autoscaling of n8n. n8n runs its triggers on every main instance, so
+// autoscaling runs n8n in queue mode and scales the workers executing workflows next to a single main instance.
+// Only the workers are scaled: the operator runs no dedicated webhook processors, webhooks are received by the
+// main instance and their executions are put on the queue for the workers.
+// +kubebuilder:validation:XValidation:rule="!self.enable || has(self.maxReplicas)",message="maxReplicas is required when enable is true"
+// +kubebuilder:validation:XValidation:rule="!self.enable || (has(self.queue) && self.queue.enable)",message="queue.enable is required when enable is true, only queue mode workers can be scaled"
+// +kubebuilder:validation:XValidation:rule="!has(self.maxReplicas) || self.minReplicas <= self.maxReplicas",message="minReplicas must not exceed maxReplicas"
+type AutoscalingConfig struct {
+	// Enable indicates whether the operator runs queue mode workers and manages an autoscaler for them
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// MinReplicas is the lower limit of worker pods
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the upper limit of worker pods
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+	// TargetCPUUtilizationPercentage is the average CPU utilization to scale on
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// TargetMemoryUtilizationPercentage is the average memory utilization to scale on
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+	// Queue configures the Redis job queue of queue mode and scaling on its depth through KEDA
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Queue *QueueScalingConfig `json:"queue,omitempty"`
+}
+
+// QueueScalingConfig defines the n8n Redis job queue and scaling on its length
+// +kubebuilder:validation:XValidation:rule="!self.enable || has(self.redisAddress)",message="redisAddress is required when enable is true"
+type QueueScalingConfig struct {
+	// Enable runs n8n in queue mode. The workers scale on the queue depth when KEDA is installed,
+	// on their resource usage otherwise.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	Enable bool `json:"enable"`
+	// RedisAddress is the host:port of the Redis server holding the queue
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:MinLength=1
+	RedisAddress string `json:"redisAddress,omitempty"`
+	// ListName is the Redis list holding waiting jobs
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default="bull:jobs:wait"
+	ListName string `json:"listName,omitempty"`
+	// ListLength is the number of waiting jobs per pod to scale on
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=5
+	ListLength int32 `json:"listLength,omitempty"`
+	// PasswordSecret references the Redis password
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	PasswordSecret *SecretKeyRef `json:"passwordSecret,omitempty"`
+}
+
+// DisruptionConfig defines the PodDisruptionBudget of the n8n pods
+// +kubebuilder:validation:XValidation:rule="!(has(self.minAvailable) && has(self.maxUnavailable))",message="minAvailable and maxUnavailable are mutually exclusive"
+type DisruptionConfig struct {
+	// Enable overrides whether a PodDisruptionBudget is created. By default one is created
+	// only when more than one n8n pod may run, so single-replica instances can still be drained.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Enable *bool `json:"enable,omitempty"`
+	// MinAvailable is the number or percentage of pods that must stay available
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// MaxUnavailable is the number or percentage of pods that may be unavailable, defaults to 1
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// BackupConfig defines where the database backups taken by the operator are stored
+type BackupConfig struct {
+	// ClaimName is the PersistentVolumeClaim the backups are written to
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+	// Image is the PostgreSQL client image running pg_dump
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default="postgres:16-alpine"
+	Image string `json:"image,omitempty"`
+	// BeforeDeletion indicates whether to back up the database before the N8n resource is deleted
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	BeforeDeletion bool `json:"beforeDeletion,omitempty"`
+}
+
+// DeletionPolicy controls what happens to the n8n data when the N8n resource is deleted
+// +kubebuilder:validation:Enum=Delete;Retain;Snapshot
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the data PersistentVolumeClaim and the generated Secrets
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the data PersistentVolumeClaim and the generated Secrets
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicySnapshot takes a VolumeSnapshot of the data PersistentVolumeClaim before deleting it
+	DeletionPolicySnapshot DeletionPolicy = "Snapshot"
+)
+
+// MaintenancePageConfig defines the static page served while the instance is suspended
+type MaintenancePageConfig struct {
+	// Enable indicates whether the Service serves the maintenance page while suspended
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Enable bool `json:"enable,omitempty"`
+	// Image serving the page, it must listen on port 8080 and serve /usr/share/nginx/html
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default="nginxinc/nginx-unprivileged:1.27-alpine"
+	Image string `json:"image,omitempty"`
+	// Message shown on the maintenance page
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default="n8n is down for maintenance"
+	Message string `json:"message,omitempty"`
+}
+
+// UpgradePolicy controls which n8n releases shipped with the operator an instance follows automatically
+// +kubebuilder:validation:Enum=Manual;Patch;Minor
+type UpgradePolicy string
+
+const (
+	// UpgradePolicyManual only changes the version when spec.version changes
+	UpgradePolicyManual UpgradePolicy = "Manual"
+	// UpgradePolicyPatch follows patch releases and holds minor and major bumps for approval
+	UpgradePolicyPatch UpgradePolicy = "Patch"
+	// UpgradePolicyMinor follows patch and minor releases and holds major bumps for approval
+	UpgradePolicyMinor UpgradePolicy = "Minor"
+)
+
+// UpgradeConfig defines how the operator rolls out n8n version changes
+type UpgradeConfig struct {
+	// Backup indicates whether to back up the database before upgrading
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Backup bool `json:"backup,omitempty"`
 }
 
 // N8nSpec defines the desired state of N8n
+// +kubebuilder:validation:XValidation:rule="!has(self.routing) || !has(self.hostname) || !self.hostname.enable",message="routing replaces hostname, set only one of them"
+// +kubebuilder:validation:XValidation:rule="!has(self.routing) || !has(self.route) || !self.route.enable",message="routing is not supported with route"
+// +kubebuilder:validation:XValidation:rule="!has(self.upgrade) || !has(self.upgrade.backup) || !self.upgrade.backup || has(self.backup)",message="backup is required when upgrade.backup is true"
 type N8nSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
@@ -142,6 +990,16 @@ type N8nSpec struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	Database Database `json:"database"`
 
+	// EncryptionKeySecret references the key n8n encrypts stored credentials with and derives its
+	// instance ID from. When unset, the operator generates a key in the <name>-encryption-key Secret
+	// for new instances.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	EncryptionKeySecret *SecretKeyRef `json:"encryptionKeySecret,omitempty"`
+
+	// Service configuration for the N8n instance
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Service *ServiceConfig `json:"service,omitempty"`
+
 	// Ingress configuration for the N8n instance
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	Ingress *IngressConfig `json:"ingress,omitempty"`
@@ -150,15 +1008,120 @@ type N8nSpec struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	HTTPRoute *HTTPRouteConfig `json:"httpRoute,omitempty"`
 
+	// Route configuration for the N8n instance on OpenShift
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Route *RouteConfig `json:"route,omitempty"`
+
 	// PersistentStorage configuration for n8n data
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	PersistentStorage *PersistentStorageConfig `json:"persistentStorage,omitempty"`
 
+	// Storage configuration for preparing the n8n data volume
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Storage *StorageConfig `json:"storage,omitempty"`
+
+	// Security configuration for the pod and container security contexts
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Security *SecurityConfig `json:"security,omitempty"`
+
+	// NetworkPolicy configuration for the traffic of the n8n pods
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	NetworkPolicy *NetworkPolicyConfig `json:"networkPolicy,omitempty"`
+
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	Metrics *MetricsConfig `json:"metrics,omitempty"`
 
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	Hostname *HostnameConfig `json:"hostname,omitempty"`
+
+	// Routing configuration serving the editor and the webhooks on separate hostnames, replaces hostname
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Routing *RoutingConfig `json:"routing,omitempty"`
+
+	// SMTP configuration for user management emails (invitations, password resets)
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	SMTP *SMTPConfig `json:"smtp,omitempty"`
+
+	// BinaryData configuration for where n8n stores binary data
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	BinaryData *BinaryDataConfig `json:"binaryData,omitempty"`
+
+	// ExternalSecrets configuration for reading credentials from an external vault
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ExternalSecrets *ExternalSecretsConfig `json:"externalSecrets,omitempty"`
+
+	// License configuration for n8n enterprise features
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	License *LicenseConfig `json:"license,omitempty"`
+
+	// Auth configuration for SAML, OIDC and LDAP login
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// Autoscaling configuration for the n8n pods
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Autoscaling *AutoscalingConfig `json:"autoscaling,omitempty"`
+
+	// Disruption configuration for voluntary disruptions of the n8n pods
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Disruption *DisruptionConfig `json:"disruption,omitempty"`
+
+	// Version of n8n to run, defaults to the version shipped with the operator. Changes are refused when they
+	// downgrade across minor releases or skip a major version; other migration requirements of n8n releases
+	// are not checked.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+\.[0-9]+$`
+	Version string `json:"version,omitempty"`
+
+	// UpgradePolicy controls which operator-shipped n8n releases are rolled out without
+	// approval when version is not set
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=Patch
+	UpgradePolicy UpgradePolicy `json:"upgradePolicy,omitempty"`
+
+	// Upgrade configuration for n8n version changes
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Upgrade *UpgradeConfig `json:"upgrade,omitempty"`
+
+	// Backup configuration for database backups taken by the operator
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Backup *BackupConfig `json:"backup,omitempty"`
+
+	// Suspend scales the n8n workloads to zero while keeping their data and configuration
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Suspend bool `json:"suspend,omitempty"`
+
+	// MaintenancePage configuration for the page served while the instance is suspended
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MaintenancePage *MaintenancePageConfig `json:"maintenancePage,omitempty"`
+
+	// DeletionPolicy controls what happens to the n8n data when the resource is deleted
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:default=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// LicenseStatus defines the observed state of the n8n license
+type LicenseStatus struct {
+	// Plan is the name of the license plan reported by n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Plan string `json:"plan,omitempty"`
+	// Features are the enterprise features enabled by the license
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Features []string `json:"features,omitempty"`
+	// MissingFeatures are the enterprise features the configuration relies on that the license doesn't grant
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	MissingFeatures []string `json:"missingFeatures,omitempty"`
+	// ActiveWorkflowTriggers is the number of active workflow triggers counted against the license quota,
+	// read when adminCredentialsSecret is set
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	ActiveWorkflowTriggers *int64 `json:"activeWorkflowTriggers,omitempty"`
+	// ActiveWorkflowTriggersLimit is the quota of active workflow triggers granted by the license, -1 when unlimited
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	ActiveWorkflowTriggersLimit *int64 `json:"activeWorkflowTriggersLimit,omitempty"`
+	// LastCheckedTime is when the license state was last read from n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	LastCheckedTime *metav1.Time `json:"lastCheckedTime,omitempty"`
 }
 
 // N8nStatus defines the observed state of N8n
@@ -166,10 +1129,37 @@ type N8nStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// License is the license state observed from n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	License *LicenseStatus `json:"license,omitempty"`
+
+	// AuthConfigHash identifies the identity provider settings last applied to n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	AuthConfigHash string `json:"authConfigHash,omitempty"`
+
+	// AuthProviders lists the identity providers the operator applied to n8n, so their login can be
+	// disabled once they are removed from the spec
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	AuthProviders []string `json:"authProviders,omitempty"`
+
+	// ExternalSecretsConfigHash identifies the external secrets provider settings last applied to n8n
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	ExternalSecretsConfigHash string `json:"externalSecretsConfigHash,omitempty"`
+
+	// Version of n8n currently rolled out
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Version string `json:"version,omitempty"`
+
+	// PreviousVersion is the version that ran before the last upgrade, used for rollbacks
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	PreviousVersion string `json:"previousVersion,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:validation:XValidation:rule="!(has(self.spec.ingress) && has(self.spec.ingress.enable) && self.spec.ingress.enable && has(self.spec.httpRoute) && has(self.spec.httpRoute.enable) && self.spec.httpRoute.enable)",message="Ingress and HTTPRoute cannot both be enabled"
+// +kubebuilder:validation:XValidation:rule="!(has(self.spec.route) && self.spec.route.enable && ((has(self.spec.ingress) && self.spec.ingress.enable) || (has(self.spec.httpRoute) && self.spec.httpRoute.enable)))",message="Route cannot be enabled together with Ingress or HTTPRoute"
+// +kubebuilder:validation:XValidation:rule="!(has(self.spec.externalSecrets) && self.spec.externalSecrets.enable) || (has(self.spec.auth) && has(self.spec.auth.adminCredentialsSecret))",message="auth.adminCredentialsSecret is required to configure external secrets"
 // +kubebuilder:subresource:status
 // N8n is the Schema for the n8ns API
 type N8n struct {
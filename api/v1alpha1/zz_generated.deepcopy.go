@@ -21,277 +21,1293 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/gateway-api/apis/v1"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Database) DeepCopyInto(out *Database) {
+func (in *AWSCredentialsSecret) DeepCopyInto(out *AWSCredentialsSecret) {
 	*out = *in
-	out.Postgres = in.Postgres
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Database.
-func (in *Database) DeepCopy() *Database {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSCredentialsSecret.
+func (in *AWSCredentialsSecret) DeepCopy() *AWSCredentialsSecret {
 	if in == nil {
 		return nil
 	}
-	out := new(Database)
+	out := new(AWSCredentialsSecret)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GatewayRef) DeepCopyInto(out *GatewayRef) {
+func (in *AWSSecretsManagerConfig) DeepCopyInto(out *AWSSecretsManagerConfig) {
 	*out = *in
+	if in.CredentialsSecret != nil {
+		in, out := &in.CredentialsSecret, &out.CredentialsSecret
+		*out = new(AWSCredentialsSecret)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayRef.
-func (in *GatewayRef) DeepCopy() *GatewayRef {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSSecretsManagerConfig.
+func (in *AWSSecretsManagerConfig) DeepCopy() *AWSSecretsManagerConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(GatewayRef)
+	out := new(AWSSecretsManagerConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *HTTPRouteConfig) DeepCopyInto(out *HTTPRouteConfig) {
+func (in *AdminCredentialsSecret) DeepCopyInto(out *AdminCredentialsSecret) {
 	*out = *in
-	out.GatewayRef = in.GatewayRef
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPRouteConfig.
-func (in *HTTPRouteConfig) DeepCopy() *HTTPRouteConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdminCredentialsSecret.
+func (in *AdminCredentialsSecret) DeepCopy() *AdminCredentialsSecret {
 	if in == nil {
 		return nil
 	}
-	out := new(HTTPRouteConfig)
+	out := new(AdminCredentialsSecret)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *HostnameConfig) DeepCopyInto(out *HostnameConfig) {
+func (in *AuthConfig) DeepCopyInto(out *AuthConfig) {
 	*out = *in
+	if in.AdminCredentialsSecret != nil {
+		in, out := &in.AdminCredentialsSecret, &out.AdminCredentialsSecret
+		*out = new(AdminCredentialsSecret)
+		**out = **in
+	}
+	if in.JustInTimeProvisioning != nil {
+		in, out := &in.JustInTimeProvisioning, &out.JustInTimeProvisioning
+		*out = new(bool)
+		**out = **in
+	}
+	if in.RedirectLoginToSSO != nil {
+		in, out := &in.RedirectLoginToSSO, &out.RedirectLoginToSSO
+		*out = new(bool)
+		**out = **in
+	}
+	if in.SAML != nil {
+		in, out := &in.SAML, &out.SAML
+		*out = new(SAMLConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OIDC != nil {
+		in, out := &in.OIDC, &out.OIDC
+		*out = new(OIDCConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LDAP != nil {
+		in, out := &in.LDAP, &out.LDAP
+		*out = new(LDAPConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostnameConfig.
-func (in *HostnameConfig) DeepCopy() *HostnameConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthConfig.
+func (in *AuthConfig) DeepCopy() *AuthConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(HostnameConfig)
+	out := new(AuthConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IngressConfig) DeepCopyInto(out *IngressConfig) {
+func (in *AutoscalingConfig) DeepCopyInto(out *AutoscalingConfig) {
 	*out = *in
-	if in.TLS != nil {
-		in, out := &in.TLS, &out.TLS
-		*out = make([]IngressTLS, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.TargetCPUUtilizationPercentage != nil {
+		in, out := &in.TargetCPUUtilizationPercentage, &out.TargetCPUUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetMemoryUtilizationPercentage != nil {
+		in, out := &in.TargetMemoryUtilizationPercentage, &out.TargetMemoryUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Queue != nil {
+		in, out := &in.Queue, &out.Queue
+		*out = new(QueueScalingConfig)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressConfig.
-func (in *IngressConfig) DeepCopy() *IngressConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingConfig.
+func (in *AutoscalingConfig) DeepCopy() *AutoscalingConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(IngressConfig)
+	out := new(AutoscalingConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IngressTLS) DeepCopyInto(out *IngressTLS) {
+func (in *BackupConfig) DeepCopyInto(out *BackupConfig) {
 	*out = *in
-	if in.Hosts != nil {
-		in, out := &in.Hosts, &out.Hosts
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupConfig.
+func (in *BackupConfig) DeepCopy() *BackupConfig {
+	if in == nil {
+		return nil
 	}
+	out := new(BackupConfig)
+	in.DeepCopyInto(out)
+	return out
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressTLS.
-func (in *IngressTLS) DeepCopy() *IngressTLS {
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BinaryDataConfig) DeepCopyInto(out *BinaryDataConfig) {
+	*out = *in
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(S3Config)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BinaryDataConfig.
+func (in *BinaryDataConfig) DeepCopy() *BinaryDataConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(IngressTLS)
+	out := new(BinaryDataConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *MetricsConfig) DeepCopyInto(out *MetricsConfig) {
+func (in *CertManagerConfig) DeepCopyInto(out *CertManagerConfig) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsConfig.
-func (in *MetricsConfig) DeepCopy() *MetricsConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManagerConfig.
+func (in *CertManagerConfig) DeepCopy() *CertManagerConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(MetricsConfig)
+	out := new(CertManagerConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *N8n) DeepCopyInto(out *N8n) {
+func (in *ConfigMapKeyRef) DeepCopyInto(out *ConfigMapKeyRef) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new N8n.
-func (in *N8n) DeepCopy() *N8n {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapKeyRef.
+func (in *ConfigMapKeyRef) DeepCopy() *ConfigMapKeyRef {
 	if in == nil {
 		return nil
 	}
-	out := new(N8n)
+	out := new(ConfigMapKeyRef)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *N8n) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Database) DeepCopyInto(out *Database) {
+	*out = *in
+	out.Postgres = in.Postgres
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Database.
+func (in *Database) DeepCopy() *Database {
+	if in == nil {
+		return nil
 	}
-	return nil
+	out := new(Database)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *N8nList) DeepCopyInto(out *N8nList) {
+func (in *DisruptionConfig) DeepCopyInto(out *DisruptionConfig) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]N8n, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.Enable != nil {
+		in, out := &in.Enable, &out.Enable
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new N8nList.
-func (in *N8nList) DeepCopy() *N8nList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DisruptionConfig.
+func (in *DisruptionConfig) DeepCopy() *DisruptionConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(N8nList)
+	out := new(DisruptionConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *N8nList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EndpointConfig) DeepCopyInto(out *EndpointConfig) {
+	*out = *in
+	if in.GatewayRef != nil {
+		in, out := &in.GatewayRef, &out.GatewayRef
+		*out = new(GatewayRef)
+		(*in).DeepCopyInto(*out)
 	}
-	return nil
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EndpointConfig.
+func (in *EndpointConfig) DeepCopy() *EndpointConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(EndpointConfig)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *N8nSpec) DeepCopyInto(out *N8nSpec) {
+func (in *ExternalSecretsConfig) DeepCopyInto(out *ExternalSecretsConfig) {
 	*out = *in
-	out.Database = in.Database
-	if in.Ingress != nil {
-		in, out := &in.Ingress, &out.Ingress
-		*out = new(IngressConfig)
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultConfig)
 		(*in).DeepCopyInto(*out)
 	}
-	if in.HTTPRoute != nil {
-		in, out := &in.HTTPRoute, &out.HTTPRoute
-		*out = new(HTTPRouteConfig)
-		**out = **in
+	if in.AWSSecretsManager != nil {
+		in, out := &in.AWSSecretsManager, &out.AWSSecretsManager
+		*out = new(AWSSecretsManagerConfig)
+		(*in).DeepCopyInto(*out)
 	}
-	if in.PersistentStorage != nil {
-		in, out := &in.PersistentStorage, &out.PersistentStorage
-		*out = new(PersistentStorageConfig)
+	if in.Infisical != nil {
+		in, out := &in.Infisical, &out.Infisical
+		*out = new(InfisicalConfig)
 		**out = **in
 	}
-	if in.Metrics != nil {
-		in, out := &in.Metrics, &out.Metrics
-		*out = new(MetricsConfig)
-		**out = **in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalSecretsConfig.
+func (in *ExternalSecretsConfig) DeepCopy() *ExternalSecretsConfig {
+	if in == nil {
+		return nil
 	}
-	if in.Hostname != nil {
-		in, out := &in.Hostname, &out.Hostname
-		*out = new(HostnameConfig)
+	out := new(ExternalSecretsConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GatewayRef) DeepCopyInto(out *GatewayRef) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
 		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new N8nSpec.
-func (in *N8nSpec) DeepCopy() *N8nSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewayRef.
+func (in *GatewayRef) DeepCopy() *GatewayRef {
 	if in == nil {
 		return nil
 	}
-	out := new(N8nSpec)
+	out := new(GatewayRef)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *N8nStatus) DeepCopyInto(out *N8nStatus) {
+func (in *HTTPRouteConfig) DeepCopyInto(out *HTTPRouteConfig) {
 	*out = *in
-	if in.Conditions != nil {
-		in, out := &in.Conditions, &out.Conditions
-		*out = make([]v1.Condition, len(*in))
+	in.GatewayRef.DeepCopyInto(&out.GatewayRef)
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(HTTPRouteTLS)
+		**out = **in
+	}
+	if in.AdditionalGatewayRefs != nil {
+		in, out := &in.AdditionalGatewayRefs, &out.AdditionalGatewayRefs
+		*out = make([]GatewayRef, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RequestHeaderModifier != nil {
+		in, out := &in.RequestHeaderModifier, &out.RequestHeaderModifier
+		*out = new(v1.HTTPHeaderFilter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResponseHeaderModifier != nil {
+		in, out := &in.ResponseHeaderModifier, &out.ResponseHeaderModifier
+		*out = new(v1.HTTPHeaderFilter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Timeouts != nil {
+		in, out := &in.Timeouts, &out.Timeouts
+		*out = new(v1.HTTPRouteTimeouts)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new N8nStatus.
-func (in *N8nStatus) DeepCopy() *N8nStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPRouteConfig.
+func (in *HTTPRouteConfig) DeepCopy() *HTTPRouteConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(N8nStatus)
+	out := new(HTTPRouteConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PersistentStorageConfig) DeepCopyInto(out *PersistentStorageConfig) {
+func (in *HTTPRouteTLS) DeepCopyInto(out *HTTPRouteTLS) {
 	*out = *in
+	out.CertManager = in.CertManager
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PersistentStorageConfig.
-func (in *PersistentStorageConfig) DeepCopy() *PersistentStorageConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPRouteTLS.
+func (in *HTTPRouteTLS) DeepCopy() *HTTPRouteTLS {
 	if in == nil {
 		return nil
 	}
-	out := new(PersistentStorageConfig)
+	out := new(HTTPRouteTLS)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Postgres) DeepCopyInto(out *Postgres) {
+func (in *HostnameConfig) DeepCopyInto(out *HostnameConfig) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Postgres.
-func (in *Postgres) DeepCopy() *Postgres {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostnameConfig.
+func (in *HostnameConfig) DeepCopy() *HostnameConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(Postgres)
+	out := new(HostnameConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfisicalConfig) DeepCopyInto(out *InfisicalConfig) {
+	*out = *in
+	out.TokenSecret = in.TokenSecret
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfisicalConfig.
+func (in *InfisicalConfig) DeepCopy() *InfisicalConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(InfisicalConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressConfig) DeepCopyInto(out *IngressConfig) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = make([]IngressTLS, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressConfig.
+func (in *IngressConfig) DeepCopy() *IngressConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressTLS) DeepCopyInto(out *IngressTLS) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CertManager != nil {
+		in, out := &in.CertManager, &out.CertManager
+		*out = new(CertManagerConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressTLS.
+func (in *IngressTLS) DeepCopy() *IngressTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPConfig) DeepCopyInto(out *LDAPConfig) {
+	*out = *in
+	if in.BindPasswordSecret != nil {
+		in, out := &in.BindPasswordSecret, &out.BindPasswordSecret
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPConfig.
+func (in *LDAPConfig) DeepCopy() *LDAPConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LicenseConfig) DeepCopyInto(out *LicenseConfig) {
+	*out = *in
+	if in.ActivationKeySecret != nil {
+		in, out := &in.ActivationKeySecret, &out.ActivationKeySecret
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.AutoRenew != nil {
+		in, out := &in.AutoRenew, &out.AutoRenew
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LicenseConfig.
+func (in *LicenseConfig) DeepCopy() *LicenseConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LicenseConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LicenseStatus) DeepCopyInto(out *LicenseStatus) {
+	*out = *in
+	if in.Features != nil {
+		in, out := &in.Features, &out.Features
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MissingFeatures != nil {
+		in, out := &in.MissingFeatures, &out.MissingFeatures
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ActiveWorkflowTriggers != nil {
+		in, out := &in.ActiveWorkflowTriggers, &out.ActiveWorkflowTriggers
+		*out = new(int64)
+		**out = **in
+	}
+	if in.ActiveWorkflowTriggersLimit != nil {
+		in, out := &in.ActiveWorkflowTriggersLimit, &out.ActiveWorkflowTriggersLimit
+		*out = new(int64)
+		**out = **in
+	}
+	if in.LastCheckedTime != nil {
+		in, out := &in.LastCheckedTime, &out.LastCheckedTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LicenseStatus.
+func (in *LicenseStatus) DeepCopy() *LicenseStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LicenseStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenancePageConfig) DeepCopyInto(out *MaintenancePageConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenancePageConfig.
+func (in *MaintenancePageConfig) DeepCopy() *MaintenancePageConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenancePageConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsConfig) DeepCopyInto(out *MetricsConfig) {
+	*out = *in
+	if in.ServiceMonitor != nil {
+		in, out := &in.ServiceMonitor, &out.ServiceMonitor
+		*out = new(MonitorConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodMonitor != nil {
+		in, out := &in.PodMonitor, &out.PodMonitor
+		*out = new(MonitorConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = new(MetricsIncludeConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsConfig.
+func (in *MetricsConfig) DeepCopy() *MetricsConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsIncludeConfig) DeepCopyInto(out *MetricsIncludeConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsIncludeConfig.
+func (in *MetricsIncludeConfig) DeepCopy() *MetricsIncludeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsIncludeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MonitorConfig) DeepCopyInto(out *MonitorConfig) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Relabelings != nil {
+		in, out := &in.Relabelings, &out.Relabelings
+		*out = make([]monitoringv1.RelabelConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MetricRelabelings != nil {
+		in, out := &in.MetricRelabelings, &out.MetricRelabelings
+		*out = make([]monitoringv1.RelabelConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TLSConfig != nil {
+		in, out := &in.TLSConfig, &out.TLSConfig
+		*out = new(monitoringv1.SafeTLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MonitorConfig.
+func (in *MonitorConfig) DeepCopy() *MonitorConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MonitorConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *N8n) DeepCopyInto(out *N8n) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new N8n.
+func (in *N8n) DeepCopy() *N8n {
+	if in == nil {
+		return nil
+	}
+	out := new(N8n)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *N8n) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *N8nList) DeepCopyInto(out *N8nList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]N8n, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new N8nList.
+func (in *N8nList) DeepCopy() *N8nList {
+	if in == nil {
+		return nil
+	}
+	out := new(N8nList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *N8nList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *N8nSpec) DeepCopyInto(out *N8nSpec) {
+	*out = *in
+	out.Database = in.Database
+	if in.EncryptionKeySecret != nil {
+		in, out := &in.EncryptionKeySecret, &out.EncryptionKeySecret
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+	if in.Service != nil {
+		in, out := &in.Service, &out.Service
+		*out = new(ServiceConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(IngressConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTPRoute != nil {
+		in, out := &in.HTTPRoute, &out.HTTPRoute
+		*out = new(HTTPRouteConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Route != nil {
+		in, out := &in.Route, &out.Route
+		*out = new(RouteConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PersistentStorage != nil {
+		in, out := &in.PersistentStorage, &out.PersistentStorage
+		*out = new(PersistentStorageConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(StorageConfig)
+		**out = **in
+	}
+	if in.Security != nil {
+		in, out := &in.Security, &out.Security
+		*out = new(SecurityConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NetworkPolicy != nil {
+		in, out := &in.NetworkPolicy, &out.NetworkPolicy
+		*out = new(NetworkPolicyConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = new(MetricsConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Hostname != nil {
+		in, out := &in.Hostname, &out.Hostname
+		*out = new(HostnameConfig)
+		**out = **in
+	}
+	if in.Routing != nil {
+		in, out := &in.Routing, &out.Routing
+		*out = new(RoutingConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SMTP != nil {
+		in, out := &in.SMTP, &out.SMTP
+		*out = new(SMTPConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BinaryData != nil {
+		in, out := &in.BinaryData, &out.BinaryData
+		*out = new(BinaryDataConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExternalSecrets != nil {
+		in, out := &in.ExternalSecrets, &out.ExternalSecrets
+		*out = new(ExternalSecretsConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.License != nil {
+		in, out := &in.License, &out.License
+		*out = new(LicenseConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(AuthConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(AutoscalingConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Disruption != nil {
+		in, out := &in.Disruption, &out.Disruption
+		*out = new(DisruptionConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(UpgradeConfig)
+		**out = **in
+	}
+	if in.Backup != nil {
+		in, out := &in.Backup, &out.Backup
+		*out = new(BackupConfig)
+		**out = **in
+	}
+	if in.MaintenancePage != nil {
+		in, out := &in.MaintenancePage, &out.MaintenancePage
+		*out = new(MaintenancePageConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new N8nSpec.
+func (in *N8nSpec) DeepCopy() *N8nSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(N8nSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *N8nStatus) DeepCopyInto(out *N8nStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.License != nil {
+		in, out := &in.License, &out.License
+		*out = new(LicenseStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AuthProviders != nil {
+		in, out := &in.AuthProviders, &out.AuthProviders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new N8nStatus.
+func (in *N8nStatus) DeepCopy() *N8nStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(N8nStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyConfig) DeepCopyInto(out *NetworkPolicyConfig) {
+	*out = *in
+	if in.IngressNamespaces != nil {
+		in, out := &in.IngressNamespaces, &out.IngressNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MonitoringNamespaces != nil {
+		in, out := &in.MonitoringNamespaces, &out.MonitoringNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EgressCIDRs != nil {
+		in, out := &in.EgressCIDRs, &out.EgressCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyConfig.
+func (in *NetworkPolicyConfig) DeepCopy() *NetworkPolicyConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCConfig) DeepCopyInto(out *OIDCConfig) {
+	*out = *in
+	if in.ClientSecret != nil {
+		in, out := &in.ClientSecret, &out.ClientSecret
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCConfig.
+func (in *OIDCConfig) DeepCopy() *OIDCConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PersistentStorageConfig) DeepCopyInto(out *PersistentStorageConfig) {
+	*out = *in
+	if in.AccessModes != nil {
+		in, out := &in.AccessModes, &out.AccessModes
+		*out = make([]corev1.PersistentVolumeAccessMode, len(*in))
+		copy(*out, *in)
+	}
+	if in.VolumeMode != nil {
+		in, out := &in.VolumeMode, &out.VolumeMode
+		*out = new(corev1.PersistentVolumeMode)
+		**out = **in
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.VolumeSource != nil {
+		in, out := &in.VolumeSource, &out.VolumeSource
+		*out = new(corev1.VolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PersistentStorageConfig.
+func (in *PersistentStorageConfig) DeepCopy() *PersistentStorageConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PersistentStorageConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Postgres) DeepCopyInto(out *Postgres) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Postgres.
+func (in *Postgres) DeepCopy() *Postgres {
+	if in == nil {
+		return nil
+	}
+	out := new(Postgres)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QueueScalingConfig) DeepCopyInto(out *QueueScalingConfig) {
+	*out = *in
+	if in.PasswordSecret != nil {
+		in, out := &in.PasswordSecret, &out.PasswordSecret
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueueScalingConfig.
+func (in *QueueScalingConfig) DeepCopy() *QueueScalingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(QueueScalingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteConfig) DeepCopyInto(out *RouteConfig) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(RouteTLS)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteConfig.
+func (in *RouteConfig) DeepCopy() *RouteConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteTLS) DeepCopyInto(out *RouteTLS) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteTLS.
+func (in *RouteTLS) DeepCopy() *RouteTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RoutingConfig) DeepCopyInto(out *RoutingConfig) {
+	*out = *in
+	in.Editor.DeepCopyInto(&out.Editor)
+	in.Webhook.DeepCopyInto(&out.Webhook)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoutingConfig.
+func (in *RoutingConfig) DeepCopy() *RoutingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RoutingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3Config) DeepCopyInto(out *S3Config) {
+	*out = *in
+	if in.CredentialsSecret != nil {
+		in, out := &in.CredentialsSecret, &out.CredentialsSecret
+		*out = new(AWSCredentialsSecret)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3Config.
+func (in *S3Config) DeepCopy() *S3Config {
+	if in == nil {
+		return nil
+	}
+	out := new(S3Config)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SAMLConfig) DeepCopyInto(out *SAMLConfig) {
+	*out = *in
+	if in.MetadataConfigMap != nil {
+		in, out := &in.MetadataConfigMap, &out.MetadataConfigMap
+		*out = new(ConfigMapKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SAMLConfig.
+func (in *SAMLConfig) DeepCopy() *SAMLConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SAMLConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SMTPConfig) DeepCopyInto(out *SMTPConfig) {
+	*out = *in
+	if in.StartTLS != nil {
+		in, out := &in.StartTLS, &out.StartTLS
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CredentialsSecret != nil {
+		in, out := &in.CredentialsSecret, &out.CredentialsSecret
+		*out = new(SMTPCredentialsSecret)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SMTPConfig.
+func (in *SMTPConfig) DeepCopy() *SMTPConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SMTPConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SMTPCredentialsSecret) DeepCopyInto(out *SMTPCredentialsSecret) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SMTPCredentialsSecret.
+func (in *SMTPCredentialsSecret) DeepCopy() *SMTPCredentialsSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(SMTPCredentialsSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyRef) DeepCopyInto(out *SecretKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyRef.
+func (in *SecretKeyRef) DeepCopy() *SecretKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecurityConfig) DeepCopyInto(out *SecurityConfig) {
+	*out = *in
+	if in.PodSecurityContext != nil {
+		in, out := &in.PodSecurityContext, &out.PodSecurityContext
+		*out = new(corev1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ContainerSecurityContext != nil {
+		in, out := &in.ContainerSecurityContext, &out.ContainerSecurityContext
+		*out = new(corev1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecurityConfig.
+func (in *SecurityConfig) DeepCopy() *SecurityConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SecurityConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceConfig) DeepCopyInto(out *ServiceConfig) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.LoadBalancerSourceRanges != nil {
+		in, out := &in.LoadBalancerSourceRanges, &out.LoadBalancerSourceRanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceConfig.
+func (in *ServiceConfig) DeepCopy() *ServiceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageConfig) DeepCopyInto(out *StorageConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageConfig.
+func (in *StorageConfig) DeepCopy() *StorageConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradeConfig) DeepCopyInto(out *UpgradeConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradeConfig.
+func (in *UpgradeConfig) DeepCopy() *UpgradeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultConfig) DeepCopyInto(out *VaultConfig) {
+	*out = *in
+	out.TokenSecret = in.TokenSecret
+	if in.CACertSecret != nil {
+		in, out := &in.CACertSecret, &out.CACertSecret
+		*out = new(SecretKeyRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultConfig.
+func (in *VaultConfig) DeepCopy() *VaultConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookEndpointConfig) DeepCopyInto(out *WebhookEndpointConfig) {
+	*out = *in
+	in.EndpointConfig.DeepCopyInto(&out.EndpointConfig)
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookEndpointConfig.
+func (in *WebhookEndpointConfig) DeepCopy() *WebhookEndpointConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookEndpointConfig)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -0,0 +1,371 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	typeAuthConfiguredN8n = "AuthConfigured"
+	authRetryInterval     = 30 * time.Second
+)
+
+// authProviderConfigPaths are the n8n API paths holding the settings of each identity provider
+var authProviderConfigPaths = map[string]string{
+	"saml": "/rest/sso/saml/config",
+	"oidc": "/rest/sso/oidc/config",
+	"ldap": "/rest/ldap/config",
+}
+
+// authProvidersConfigured reports whether any identity provider is declared and must be applied through the n8n API
+func authProvidersConfigured(n8n *n8nv1alpha1.N8n) bool {
+	auth := n8n.Spec.Auth
+	return auth != nil && (auth.SAML != nil || auth.OIDC != nil || auth.LDAP != nil)
+}
+
+// configuredAuthProviders returns the identity providers declared in the spec
+func configuredAuthProviders(n8n *n8nv1alpha1.N8n) []string {
+	auth := n8n.Spec.Auth
+	var providers []string
+	if auth == nil {
+		return providers
+	}
+	if auth.LDAP != nil {
+		providers = append(providers, "ldap")
+	}
+	if auth.OIDC != nil {
+		providers = append(providers, "oidc")
+	}
+	if auth.SAML != nil {
+		providers = append(providers, "saml")
+	}
+	return providers
+}
+
+// droppedAuthProviders returns the identity providers the operator applied to n8n that are no longer declared
+func droppedAuthProviders(n8n *n8nv1alpha1.N8n) []string {
+	configured := configuredAuthProviders(n8n)
+	var dropped []string
+	for _, provider := range n8n.Status.AuthProviders {
+		if !slices.Contains(configured, provider) {
+			dropped = append(dropped, provider)
+		}
+	}
+	return dropped
+}
+
+// getAuthEnvVars returns the environment variables configuring SSO behavior
+func getAuthEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
+	if n8n.Spec.Auth == nil {
+		return nil
+	}
+
+	var envVars []corev1.EnvVar
+	if n8n.Spec.Auth.JustInTimeProvisioning != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "N8N_SSO_JUST_IN_TIME_PROVISIONING",
+			Value: fmt.Sprintf("%t", *n8n.Spec.Auth.JustInTimeProvisioning),
+		})
+	}
+	if n8n.Spec.Auth.RedirectLoginToSSO != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "N8N_SSO_REDIRECT_LOGIN_TO_SSO",
+			Value: fmt.Sprintf("%t", *n8n.Spec.Auth.RedirectLoginToSSO),
+		})
+	}
+	return envVars
+}
+
+// authReferences returns the Secrets and ConfigMaps the identity provider settings are read from,
+// or why one of them is unusable
+func (r *N8nReconciler) authReferences(ctx context.Context, n8n *n8nv1alpha1.N8n) ([]client.Object, string, error) {
+	auth := n8n.Spec.Auth
+	var secrets []n8nv1alpha1.SecretKeyRef
+	var configMaps []n8nv1alpha1.ConfigMapKeyRef
+	if auth.SAML != nil && auth.SAML.MetadataConfigMap != nil {
+		configMaps = append(configMaps, *auth.SAML.MetadataConfigMap)
+	}
+	if auth.OIDC != nil && auth.OIDC.ClientSecret != nil {
+		secrets = append(secrets, *auth.OIDC.ClientSecret)
+	}
+	if auth.LDAP != nil && auth.LDAP.BindPasswordSecret != nil {
+		secrets = append(secrets, *auth.LDAP.BindPasswordSecret)
+	}
+
+	var referenced []client.Object
+	for _, ref := range secrets {
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: n8n.Namespace}, secret)
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Sprintf("Secret %s was not found", ref.Name), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if _, ok := secret.Data[ref.Key]; !ok {
+			return nil, fmt.Sprintf("Secret %s does not contain key %s", ref.Name, ref.Key), nil
+		}
+		referenced = append(referenced, secret)
+	}
+	for _, ref := range configMaps {
+		cm := &corev1.ConfigMap{}
+		err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: n8n.Namespace}, cm)
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Sprintf("ConfigMap %s was not found", ref.Name), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if _, ok := cm.Data[ref.Key]; !ok {
+			return nil, fmt.Sprintf("ConfigMap %s does not contain key %s", ref.Name, ref.Key), nil
+		}
+		referenced = append(referenced, cm)
+	}
+	return referenced, "", nil
+}
+
+// reconcileAuth applies the identity provider settings through the n8n API once n8n is available
+func (r *N8nReconciler) reconcileAuth(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	dropped := droppedAuthProviders(n8n)
+	if !authProvidersConfigured(n8n) {
+		if len(dropped) > 0 {
+			return r.removeAuth(ctx, n8n, dropped)
+		}
+		changed := meta.RemoveStatusCondition(&n8n.Status.Conditions, typeAuthConfiguredN8n)
+		if n8n.Status.AuthConfigHash != "" {
+			n8n.Status.AuthConfigHash = ""
+			changed = true
+		}
+		if changed {
+			return r.Status().Update(ctx, n8n)
+		}
+		return nil
+	}
+
+	referenced, problem, err := r.authReferences(ctx, n8n)
+	if err != nil {
+		return err
+	}
+	if problem != "" {
+		return r.updateStatus(ctx, n8n, typeAuthConfiguredN8n, metav1.ConditionFalse, "ReferenceNotFound",
+			fmt.Sprintf("Identity provider settings can't be read: %s", problem))
+	}
+
+	// n8n keeps the settings in its database, they are applied again when they or the objects
+	// they are read from change
+	hash := appliedConfigHash(n8n.Spec.Auth, referenced)
+	providers := configuredAuthProviders(n8n)
+	if hash == n8n.Status.AuthConfigHash && slices.Equal(providers, n8n.Status.AuthProviders) &&
+		meta.IsStatusConditionTrue(n8n.Status.Conditions, typeAuthConfiguredN8n) {
+		return nil
+	}
+
+	available, err := r.n8nAvailable(ctx, n8n)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return r.updateStatus(ctx, n8n, typeAuthConfiguredN8n, metav1.ConditionUnknown, "WaitingForN8n",
+			"Waiting for n8n to become available before applying identity provider settings")
+	}
+
+	apiClient, err := r.ownerClient(ctx, n8n, n8nServiceURL(n8n))
+	if err == nil {
+		err = apiClient.disableAuthProviders(ctx, dropped)
+	}
+	if err == nil {
+		err = r.applyAuth(ctx, n8n, apiClient)
+	}
+	if err != nil {
+		if err := r.updateStatus(ctx, n8n, typeAuthConfiguredN8n, metav1.ConditionFalse, "ApplyFailed",
+			fmt.Sprintf("Failed to apply identity provider settings: %v", err)); err != nil {
+			return err
+		}
+		// Returning the error retries with backoff
+		return fmt.Errorf("failed to apply identity provider settings: %w", err)
+	}
+
+	n8n.Status.AuthConfigHash = hash
+	n8n.Status.AuthProviders = providers
+	return r.updateStatus(ctx, n8n, typeAuthConfiguredN8n, metav1.ConditionTrue, "Applied",
+		"Identity provider settings applied")
+}
+
+// removeAuth disables the login of the identity providers the operator applied once none is declared anymore
+func (r *N8nReconciler) removeAuth(ctx context.Context, n8n *n8nv1alpha1.N8n, dropped []string) error {
+	if n8n.Spec.Auth == nil || n8n.Spec.Auth.AdminCredentialsSecret == nil {
+		// Without the owner credentials there is no way to log in to n8n anymore
+		r.Recorder.Event(n8n, "Warning", "AuthNotDisabled",
+			fmt.Sprintf("Can't disable the %s login in n8n without auth.adminCredentialsSecret", strings.Join(dropped, ", ")))
+	} else {
+		available, err := r.n8nAvailable(ctx, n8n)
+		if err != nil {
+			return err
+		}
+		if !available {
+			return r.updateStatus(ctx, n8n, typeAuthConfiguredN8n, metav1.ConditionUnknown, "WaitingForN8n",
+				"Waiting for n8n to become available before disabling identity providers")
+		}
+
+		apiClient, err := r.ownerClient(ctx, n8n, n8nServiceURL(n8n))
+		if err == nil {
+			err = apiClient.disableAuthProviders(ctx, dropped)
+		}
+		if err != nil {
+			if err := r.updateStatus(ctx, n8n, typeAuthConfiguredN8n, metav1.ConditionFalse, "DisableFailed",
+				fmt.Sprintf("Failed to disable identity providers: %v", err)); err != nil {
+				return err
+			}
+			// Returning the error retries with backoff
+			return fmt.Errorf("failed to disable identity providers: %w", err)
+		}
+	}
+
+	meta.RemoveStatusCondition(&n8n.Status.Conditions, typeAuthConfiguredN8n)
+	n8n.Status.AuthConfigHash = ""
+	n8n.Status.AuthProviders = nil
+	return r.Status().Update(ctx, n8n)
+}
+
+// disableAuthProviders turns off the login of the identity providers, keeping the rest of their settings
+func (c *n8nAPIClient) disableAuthProviders(ctx context.Context, providers []string) error {
+	for _, provider := range providers {
+		path := authProviderConfigPaths[provider]
+		current := &struct {
+			Data map[string]interface{} `json:"data"`
+		}{}
+		if _, err := c.do(ctx, http.MethodGet, path, nil, current); err != nil {
+			return fmt.Errorf("failed to read %s settings: %w", provider, err)
+		}
+		config := current.Data
+		if config == nil {
+			config = map[string]interface{}{}
+		}
+		config["loginEnabled"] = false
+
+		// n8n saves the LDAP settings with PUT and the SSO settings with POST
+		method := http.MethodPost
+		if provider == "ldap" {
+			method = http.MethodPut
+		}
+		if _, err := c.do(ctx, method, path, config, nil); err != nil {
+			return fmt.Errorf("failed to disable %s login: %w", provider, err)
+		}
+	}
+	return nil
+}
+
+// applyAuth pushes the SAML, OIDC and LDAP settings with a client logged in as the owner
+func (r *N8nReconciler) applyAuth(ctx context.Context, n8n *n8nv1alpha1.N8n, client *n8nAPIClient) error {
+	auth := n8n.Spec.Auth
+	if auth.SAML != nil {
+		if err := r.applySAML(ctx, n8n, client); err != nil {
+			return err
+		}
+	}
+	if auth.OIDC != nil {
+		if err := r.applyOIDC(ctx, n8n, client); err != nil {
+			return err
+		}
+	}
+	if auth.LDAP != nil {
+		if err := r.applyLDAP(ctx, n8n, client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *N8nReconciler) applySAML(ctx context.Context, n8n *n8nv1alpha1.N8n, client *n8nAPIClient) error {
+	saml := n8n.Spec.Auth.SAML
+	config := map[string]interface{}{
+		"loginEnabled": saml.Enable,
+	}
+	if saml.MetadataConfigMap != nil {
+		metadata, err := r.configMapValue(ctx, n8n.Namespace, saml.MetadataConfigMap.Name, saml.MetadataConfigMap.Key)
+		if err != nil {
+			return err
+		}
+		config["metadata"] = metadata
+	}
+	if saml.MetadataURL != "" {
+		config["metadataUrl"] = saml.MetadataURL
+	}
+
+	if _, err := client.do(ctx, http.MethodPost, authProviderConfigPaths["saml"], config, nil); err != nil {
+		return fmt.Errorf("failed to apply SAML settings: %w", err)
+	}
+	return nil
+}
+
+func (r *N8nReconciler) applyOIDC(ctx context.Context, n8n *n8nv1alpha1.N8n, client *n8nAPIClient) error {
+	oidc := n8n.Spec.Auth.OIDC
+	config := map[string]interface{}{
+		"loginEnabled":      oidc.Enable,
+		"discoveryEndpoint": oidc.DiscoveryEndpoint,
+		"clientId":          oidc.ClientID,
+	}
+	if oidc.ClientSecret != nil {
+		clientSecret, err := r.secretValue(ctx, n8n.Namespace, oidc.ClientSecret.Name, oidc.ClientSecret.Key)
+		if err != nil {
+			return err
+		}
+		config["clientSecret"] = clientSecret
+	}
+
+	if _, err := client.do(ctx, http.MethodPost, authProviderConfigPaths["oidc"], config, nil); err != nil {
+		return fmt.Errorf("failed to apply OIDC settings: %w", err)
+	}
+	return nil
+}
+
+func (r *N8nReconciler) applyLDAP(ctx context.Context, n8n *n8nv1alpha1.N8n, client *n8nAPIClient) error {
+	ldap := n8n.Spec.Auth.LDAP
+	bindPassword := ""
+	if ldap.BindPasswordSecret != nil {
+		var err error
+		bindPassword, err = r.secretValue(ctx, n8n.Namespace, ldap.BindPasswordSecret.Name, ldap.BindPasswordSecret.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	config := map[string]interface{}{
+		"loginEnabled":            ldap.Enable,
+		"loginLabel":              "",
+		"connectionUrl":           ldap.Host,
+		"connectionPort":          ldap.Port,
+		"connectionSecurity":      ldap.ConnectionSecurity,
+		"allowUnauthorizedCerts":  ldap.AllowUnauthorizedCerts,
+		"baseDn":                  ldap.BaseDN,
+		"bindingAdminDn":          ldap.BindDN,
+		"bindingAdminPassword":    bindPassword,
+		"userFilter":              ldap.UserFilter,
+		"loginIdAttribute":        ldap.LoginIDAttribute,
+		"emailAttribute":          ldap.EmailAttribute,
+		"firstNameAttribute":      ldap.FirstNameAttribute,
+		"lastNameAttribute":       ldap.LastNameAttribute,
+		"ldapIdAttribute":         ldap.IDAttribute,
+		"synchronizationEnabled":  ldap.SynchronizationInterval > 0,
+		"synchronizationInterval": ldap.SynchronizationInterval,
+		"searchPageSize":          0,
+		"searchTimeout":           60,
+	}
+
+	if _, err := client.do(ctx, http.MethodPut, authProviderConfigPaths["ldap"], config, nil); err != nil {
+		return fmt.Errorf("failed to apply LDAP settings: %w", err)
+	}
+	return nil
+}
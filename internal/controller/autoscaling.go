@@ -0,0 +1,277 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	scaledObjectGVK          = schema.GroupVersionKind{Group: "keda.sh", Version: "v1alpha1", Kind: "ScaledObject"}
+	triggerAuthenticationGVK = schema.GroupVersionKind{Group: "keda.sh", Version: "v1alpha1", Kind: "TriggerAuthentication"}
+)
+
+// autoscalingEnabled reports whether an autoscaler manages the workers. The workers are stopped while
+// suspended and while a version rollout migrates the database.
+func autoscalingEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.Autoscaling != nil && n8n.Spec.Autoscaling.Enable && !suspended(n8n) && !upgrading(n8n)
+}
+
+func queueScalingEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return autoscalingEnabled(n8n) && n8n.Spec.Autoscaling.Queue != nil && n8n.Spec.Autoscaling.Queue.Enable
+}
+
+// apiAvailable reports whether the cluster serves the given kind
+func (r *N8nReconciler) apiAvailable(gvk schema.GroupVersionKind) (bool, error) {
+	_, err := r.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *N8nReconciler) horizontalPodAutoscalerForN8n(n8n *n8nv1alpha1.N8n) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	as := n8n.Spec.Autoscaling
+	minReplicas := as.MinReplicas
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n8n.Name,
+			Namespace: n8n.Namespace,
+			Labels:    labelsForN8n(),
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       workerName(n8n),
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: as.MaxReplicas,
+		},
+	}
+
+	if as.TargetCPUUtilizationPercentage != nil {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, resourceMetric(corev1.ResourceCPU, *as.TargetCPUUtilizationPercentage))
+	}
+	if as.TargetMemoryUtilizationPercentage != nil {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, resourceMetric(corev1.ResourceMemory, *as.TargetMemoryUtilizationPercentage))
+	}
+
+	if err := ctrl.SetControllerReference(n8n, hpa, r.Scheme); err != nil {
+		return nil, err
+	}
+	return hpa, nil
+}
+
+func resourceMetric(name corev1.ResourceName, utilization int32) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2.MetricTarget{
+				Type:               autoscalingv2.UtilizationMetricType,
+				AverageUtilization: &utilization,
+			},
+		},
+	}
+}
+
+// scaledObjectForN8n builds a KEDA ScaledObject scaling the workers on the Redis queue depth and resource usage
+func (r *N8nReconciler) scaledObjectForN8n(n8n *n8nv1alpha1.N8n) (*unstructured.Unstructured, error) {
+	as := n8n.Spec.Autoscaling
+	queue := as.Queue
+
+	redisTrigger := map[string]interface{}{
+		"type": "redis",
+		"metadata": map[string]interface{}{
+			"address":    queue.RedisAddress,
+			"listName":   queue.ListName,
+			"listLength": fmt.Sprintf("%d", queue.ListLength),
+		},
+	}
+	if queue.PasswordSecret != nil {
+		redisTrigger["authenticationRef"] = map[string]interface{}{"name": n8n.Name}
+	}
+	triggers := []interface{}{redisTrigger}
+	if as.TargetCPUUtilizationPercentage != nil {
+		triggers = append(triggers, resourceTrigger("cpu", *as.TargetCPUUtilizationPercentage))
+	}
+	if as.TargetMemoryUtilizationPercentage != nil {
+		triggers = append(triggers, resourceTrigger("memory", *as.TargetMemoryUtilizationPercentage))
+	}
+
+	so := &unstructured.Unstructured{}
+	so.SetGroupVersionKind(scaledObjectGVK)
+	so.SetName(n8n.Name)
+	so.SetNamespace(n8n.Namespace)
+	so.SetLabels(labelsForN8n())
+	so.Object["spec"] = map[string]interface{}{
+		"scaleTargetRef": map[string]interface{}{
+			"name": workerName(n8n),
+		},
+		"minReplicaCount": int64(as.MinReplicas),
+		"maxReplicaCount": int64(as.MaxReplicas),
+		"triggers":        triggers,
+	}
+
+	if err := ctrl.SetControllerReference(n8n, so, r.Scheme); err != nil {
+		return nil, err
+	}
+	return so, nil
+}
+
+func resourceTrigger(resource string, utilization int32) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       resource,
+		"metricType": "Utilization",
+		"metadata": map[string]interface{}{
+			"value": fmt.Sprintf("%d", utilization),
+		},
+	}
+}
+
+// triggerAuthenticationForN8n builds the KEDA TriggerAuthentication holding the Redis password
+func (r *N8nReconciler) triggerAuthenticationForN8n(n8n *n8nv1alpha1.N8n) (*unstructured.Unstructured, error) {
+	password := n8n.Spec.Autoscaling.Queue.PasswordSecret
+
+	ta := &unstructured.Unstructured{}
+	ta.SetGroupVersionKind(triggerAuthenticationGVK)
+	ta.SetName(n8n.Name)
+	ta.SetNamespace(n8n.Namespace)
+	ta.SetLabels(labelsForN8n())
+	ta.Object["spec"] = map[string]interface{}{
+		"secretTargetRef": []interface{}{
+			map[string]interface{}{
+				"parameter": "password",
+				"name":      password.Name,
+				"key":       password.Key,
+			},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(n8n, ta, r.Scheme); err != nil {
+		return nil, err
+	}
+	return ta, nil
+}
+
+// createOrUpdateAutoscaler reconciles the HorizontalPodAutoscaler or, for queue-based scaling, the KEDA ScaledObject
+func (r *N8nReconciler) createOrUpdateAutoscaler(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	useKEDA := false
+	kedaAvailable, err := r.apiAvailable(scaledObjectGVK)
+	if err != nil {
+		return err
+	}
+	if queueScalingEnabled(n8n) {
+		if kedaAvailable {
+			useKEDA = true
+		} else {
+			r.Recorder.Event(n8n, "Warning", "KEDANotInstalled",
+				"Queue-based autoscaling requires KEDA, falling back to a HorizontalPodAutoscaler")
+		}
+	}
+
+	// Only one autoscaler may own the worker Deployment, remove the one that doesn't apply
+	if !autoscalingEnabled(n8n) || useKEDA {
+		if err := r.deleteIfExists(ctx, n8n, &autoscalingv2.HorizontalPodAutoscaler{}); err != nil {
+			return err
+		}
+	}
+	if kedaAvailable && !useKEDA {
+		if err := r.deleteIfExists(ctx, n8n, newUnstructured(scaledObjectGVK)); err != nil {
+			return err
+		}
+		if err := r.deleteIfExists(ctx, n8n, newUnstructured(triggerAuthenticationGVK)); err != nil {
+			return err
+		}
+	}
+	if !autoscalingEnabled(n8n) {
+		return nil
+	}
+
+	if !useKEDA {
+		hpa, err := r.horizontalPodAutoscalerForN8n(n8n)
+		if err != nil {
+			return err
+		}
+		return r.createOrUpdateSpec(ctx, hpa, &autoscalingv2.HorizontalPodAutoscaler{}, func(existing client.Object) bool {
+			// Compare only the fields the operator owns, the API server defaults the scaling behavior
+			current := existing.(*autoscalingv2.HorizontalPodAutoscaler)
+			if reflect.DeepEqual(current.Spec.ScaleTargetRef, hpa.Spec.ScaleTargetRef) &&
+				reflect.DeepEqual(current.Spec.MinReplicas, hpa.Spec.MinReplicas) &&
+				current.Spec.MaxReplicas == hpa.Spec.MaxReplicas &&
+				reflect.DeepEqual(current.Spec.Metrics, hpa.Spec.Metrics) {
+				return false
+			}
+			current.Spec.ScaleTargetRef = hpa.Spec.ScaleTargetRef
+			current.Spec.MinReplicas = hpa.Spec.MinReplicas
+			current.Spec.MaxReplicas = hpa.Spec.MaxReplicas
+			current.Spec.Metrics = hpa.Spec.Metrics
+			return true
+		})
+	}
+
+	if n8n.Spec.Autoscaling.Queue.PasswordSecret != nil {
+		ta, err := r.triggerAuthenticationForN8n(n8n)
+		if err != nil {
+			return err
+		}
+		if err := r.createOrUpdateUnstructuredSpec(ctx, ta); err != nil {
+			return err
+		}
+	} else if err := r.deleteIfExists(ctx, n8n, newUnstructured(triggerAuthenticationGVK)); err != nil {
+		return err
+	}
+
+	so, err := r.scaledObjectForN8n(n8n)
+	if err != nil {
+		return err
+	}
+	return r.createOrUpdateUnstructuredSpec(ctx, so)
+}
+
+func newUnstructured(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+// createOrUpdateUnstructuredSpec creates an unstructured object or replaces the spec of the existing one
+func (r *N8nReconciler) createOrUpdateUnstructuredSpec(ctx context.Context, desired *unstructured.Unstructured) error {
+	return r.createOrUpdateSpec(ctx, desired, newUnstructured(desired.GroupVersionKind()), func(existing client.Object) bool {
+		current := existing.(*unstructured.Unstructured)
+		if reflect.DeepEqual(current.Object["spec"], desired.Object["spec"]) {
+			return false
+		}
+		current.Object["spec"] = desired.Object["spec"]
+		return true
+	})
+}
+
+// createOrUpdateSpec creates desired if it doesn't exist, otherwise lets mutate copy the desired
+// state into the existing object and updates it when mutate reports a change
+func (r *N8nReconciler) createOrUpdateSpec(ctx context.Context, desired, existing client.Object, mutate func(existing client.Object) bool) error {
+	err := r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, existing)
+	if apierrors.IsNotFound(err) {
+		return r.Create(ctx, desired)
+	}
+	if err != nil {
+		return err
+	}
+	if !mutate(existing) {
+		return nil
+	}
+	return r.Update(ctx, existing)
+}
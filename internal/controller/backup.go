@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	defaultBackupImage = "postgres:16-alpine"
+	backupMountPath    = "/backup"
+	// finalBackupTTL is how long the final backup Job, which outlives the N8n resource, is kept once finished
+	finalBackupTTL = 7 * 24 * time.Hour
+)
+
+// backupJobForN8n builds a Job dumping the n8n database into the backup volume.
+// The dump is named after the N8n resource, the given label and the time it was taken.
+// The Job is owned by the N8n resource unless it runs while the resource is deleted.
+func (r *N8nReconciler) backupJobForN8n(n8n *n8nv1alpha1.N8n, name, label string) (*batchv1.Job, error) {
+	backup := n8n.Spec.Backup
+	image := backup.Image
+	if image == "" {
+		image = defaultBackupImage
+	}
+
+	pg := n8n.Spec.Database.Postgres
+	sslMode := "prefer"
+	if pg.Ssl {
+		sslMode = "require"
+	}
+
+	backoffLimit := int32(1)
+	labels := labelsForN8n()
+	labels[instanceLabel] = n8n.Name
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: n8n.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy:   corev1.RestartPolicyNever,
+					SecurityContext: getPodSecurityContext(n8n),
+					Volumes: []corev1.Volume{{
+						Name: "backup",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+								ClaimName: backup.ClaimName,
+							},
+						},
+					}},
+					Containers: []corev1.Container{{
+						Name:            "pg-dump",
+						Image:           image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						SecurityContext: getContainerSecurityContext(n8n),
+						Command: []string{
+							"sh",
+							"-c",
+							`set -eo pipefail; pg_dump --no-owner | gzip > "` + backupMountPath + `/${BACKUP_PREFIX}-$(date +%Y%m%d%H%M%S).sql.gz"`,
+						},
+						Env: []corev1.EnvVar{
+							{Name: "BACKUP_PREFIX", Value: fmt.Sprintf("%s-%s", n8n.Name, label)},
+							{Name: "PGHOST", Value: pg.Host},
+							{Name: "PGPORT", Value: fmt.Sprintf("%d", pg.Port)},
+							{Name: "PGDATABASE", Value: pg.Database},
+							{Name: "PGUSER", Value: pg.User},
+							{Name: "PGPASSWORD", Value: pg.Password},
+							{Name: "PGSSLMODE", Value: sslMode},
+						},
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      "backup",
+							MountPath: backupMountPath,
+						}},
+					}},
+				},
+			},
+		},
+	}
+
+	// The garbage collector would delete a Job owned by a resource being deleted, and the finalizer would
+	// create it again
+	if n8n.GetDeletionTimestamp() != nil {
+		ttl := int32(finalBackupTTL.Seconds())
+		job.Spec.TTLSecondsAfterFinished = &ttl
+		return job, nil
+	}
+	if err := ctrl.SetControllerReference(n8n, job, r.Scheme); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// jobFinished reports whether a Job has finished and whether it succeeded
+func jobFinished(job *batchv1.Job) (finished bool, succeeded bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, true
+		case batchv1.JobFailed:
+			return true, false
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"fmt"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// binaryDataMode returns the configured binary data mode, defaulting to filesystem
+func binaryDataMode(n8n *n8nv1alpha1.N8n) n8nv1alpha1.BinaryDataMode {
+	if n8n.Spec.BinaryData == nil || n8n.Spec.BinaryData.Mode == "" {
+		return n8nv1alpha1.BinaryDataModeFilesystem
+	}
+	return n8n.Spec.BinaryData.Mode
+}
+
+// getBinaryDataEnvVars returns the environment variables configuring binary data storage
+func getBinaryDataEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
+	if n8n.Spec.BinaryData == nil {
+		return nil
+	}
+
+	mode := binaryDataMode(n8n)
+	envVars := []corev1.EnvVar{
+		{
+			Name:  "N8N_DEFAULT_BINARY_DATA_MODE",
+			Value: string(mode),
+		},
+	}
+
+	s3 := n8n.Spec.BinaryData.S3
+	if mode != n8nv1alpha1.BinaryDataModeS3 || s3 == nil {
+		return envVars
+	}
+
+	envVars = append(envVars,
+		corev1.EnvVar{
+			// Keep filesystem readable so data written before switching to s3 stays available
+			Name:  "N8N_AVAILABLE_BINARY_DATA_MODES",
+			Value: "filesystem,s3",
+		},
+		corev1.EnvVar{
+			Name:  "N8N_EXTERNAL_STORAGE_S3_HOST",
+			Value: s3.Endpoint,
+		},
+		corev1.EnvVar{
+			Name:  "N8N_EXTERNAL_STORAGE_S3_BUCKET_NAME",
+			Value: s3.Bucket,
+		},
+	)
+
+	if s3.Region != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "N8N_EXTERNAL_STORAGE_S3_BUCKET_REGION",
+			Value: s3.Region,
+		})
+	}
+
+	if s3.CredentialsSecret != nil {
+		envVars = append(envVars,
+			secretEnvVar("N8N_EXTERNAL_STORAGE_S3_ACCESS_KEY", s3.CredentialsSecret.Name, s3.CredentialsSecret.AccessKeyIDKey),
+			secretEnvVar("N8N_EXTERNAL_STORAGE_S3_ACCESS_SECRET", s3.CredentialsSecret.Name, s3.CredentialsSecret.SecretAccessKeyKey),
+		)
+	} else {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "N8N_EXTERNAL_STORAGE_S3_AUTH_AUTO_DETECT",
+			Value: "true",
+		})
+	}
+
+	return envVars
+}
+
+// validateBinaryData refuses filesystem binary data when the queue mode workers would not share it with the main instance.
+// Without spec.binaryData no mode is set and n8n keeps binary data in its default in-memory mode, so only an explicit
+// filesystem mode is refused.
+func validateBinaryData(n8n *n8nv1alpha1.N8n, sharedStorage bool) error {
+	if n8n.Spec.BinaryData == nil || binaryDataMode(n8n) != n8nv1alpha1.BinaryDataModeFilesystem || sharedStorage {
+		return nil
+	}
+	if replicas := maxReplicasForN8n(n8n); replicas > 1 {
+		return fmt.Errorf("binary data mode filesystem requires shared storage when running up to %d n8n pods, use s3 or a ReadWriteMany volume instead", replicas)
+	}
+	return nil
+}
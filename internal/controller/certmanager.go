@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	typeCertificateReadyN8n = "CertificateReady"
+	certificatePollInterval = 30 * time.Second
+	issuerAnnotation        = "cert-manager.io/issuer"
+	clusterIssuerAnnotation = "cert-manager.io/cluster-issuer"
+	certificateNameSuffix   = "-tls"
+	issuerKind              = "Issuer"
+	clusterIssuerKind       = "ClusterIssuer"
+)
+
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// ingressCertManager returns the cert-manager configuration of the Ingress TLS entries, cert-manager
+// annotates a whole Ingress so the first configured entry applies to all of them
+func ingressCertManager(n8n *n8nv1alpha1.N8n) *n8nv1alpha1.CertManagerConfig {
+	if n8n.Spec.Ingress == nil || !n8n.Spec.Ingress.Enable {
+		return nil
+	}
+	for _, tls := range n8n.Spec.Ingress.TLS {
+		if tls.CertManager != nil {
+			return tls.CertManager
+		}
+	}
+	return nil
+}
+
+func httpRouteCertificateEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.HTTPRoute != nil && n8n.Spec.HTTPRoute.Enable && n8n.Spec.HTTPRoute.TLS != nil
+}
+
+func certManagerEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return ingressCertManager(n8n) != nil || httpRouteCertificateEnabled(n8n)
+}
+
+// certManagerAnnotations returns the annotations making cert-manager issue the Ingress certificates
+func certManagerAnnotations(n8n *n8nv1alpha1.N8n) map[string]string {
+	config := ingressCertManager(n8n)
+	if config == nil {
+		return nil
+	}
+	if config.ClusterIssuer != "" {
+		return map[string]string{clusterIssuerAnnotation: config.ClusterIssuer}
+	}
+	return map[string]string{issuerAnnotation: config.Issuer}
+}
+
+// certificateNamesForN8n returns the Certificates whose readiness is reported. cert-manager names
+// the Certificates of an Ingress after their Secrets.
+func certificateNamesForN8n(n8n *n8nv1alpha1.N8n) []string {
+	if httpRouteCertificateEnabled(n8n) {
+		return []string{n8n.Name + certificateNameSuffix}
+	}
+	if ingressCertManager(n8n) == nil {
+		return nil
+	}
+	var names []string
+	for _, tls := range n8n.Spec.Ingress.TLS {
+		if tls.SecretName != "" {
+			names = append(names, tls.SecretName)
+		}
+	}
+	return names
+}
+
+// certificateForN8n returns the Certificate covering the HTTPRoute hostnames
+func (r *N8nReconciler) certificateForN8n(n8n *n8nv1alpha1.N8n) (*unstructured.Unstructured, error) {
+	tls := n8n.Spec.HTTPRoute.TLS
+	issuerRef := map[string]interface{}{
+		"name": tls.CertManager.Issuer,
+		"kind": issuerKind,
+	}
+	if tls.CertManager.ClusterIssuer != "" {
+		issuerRef = map[string]interface{}{
+			"name": tls.CertManager.ClusterIssuer,
+			"kind": clusterIssuerKind,
+		}
+	}
+
+	var dnsNames []interface{}
+	for _, endpoint := range endpointsForN8n(n8n) {
+		dnsNames = append(dnsNames, endpoint.host)
+	}
+
+	cert := newUnstructured(certificateGVK)
+	cert.SetName(n8n.Name + certificateNameSuffix)
+	cert.SetNamespace(n8n.Namespace)
+	cert.SetLabels(labelsForN8n())
+	cert.Object["spec"] = map[string]interface{}{
+		"secretName": tls.SecretName,
+		"dnsNames":   dnsNames,
+		"issuerRef":  issuerRef,
+	}
+	if err := ctrl.SetControllerReference(n8n, cert, r.Scheme); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// reconcileCertificates creates the Certificate for HTTPRoute setups and reports whether the certificates are ready
+func (r *N8nReconciler) reconcileCertificates(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	available, err := r.apiAvailable(certificateGVK)
+	if err != nil {
+		return err
+	}
+
+	if available && !httpRouteCertificateEnabled(n8n) {
+		if err := r.deleteNamedIfExists(ctx, n8n, newUnstructured(certificateGVK), n8n.Name+certificateNameSuffix); err != nil {
+			return err
+		}
+	}
+	if !certManagerEnabled(n8n) {
+		if meta.FindStatusCondition(n8n.Status.Conditions, typeCertificateReadyN8n) != nil {
+			meta.RemoveStatusCondition(&n8n.Status.Conditions, typeCertificateReadyN8n)
+			return r.Status().Update(ctx, n8n)
+		}
+		return nil
+	}
+
+	if !available {
+		if !meta.IsStatusConditionFalse(n8n.Status.Conditions, typeCertificateReadyN8n) {
+			r.Recorder.Event(n8n, "Warning", "CertManagerNotInstalled", "TLS certificates require cert-manager")
+		}
+		return r.updateStatus(ctx, n8n, typeCertificateReadyN8n, metav1.ConditionFalse, "CertManagerNotInstalled",
+			"TLS certificates require cert-manager")
+	}
+
+	if httpRouteCertificateEnabled(n8n) {
+		cert, err := r.certificateForN8n(n8n)
+		if err != nil {
+			return err
+		}
+		if err := r.createOrUpdateUnstructuredSpec(ctx, cert); err != nil {
+			return err
+		}
+	}
+
+	var pending []string
+	for _, name := range certificateNamesForN8n(n8n) {
+		cert := newUnstructured(certificateGVK)
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: n8n.Namespace}, cert)
+		if apierrors.IsNotFound(err) {
+			pending = append(pending, name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !certificateReady(cert) {
+			pending = append(pending, name)
+		}
+	}
+
+	if len(pending) > 0 {
+		return r.updateStatus(ctx, n8n, typeCertificateReadyN8n, metav1.ConditionFalse, "Issuing",
+			fmt.Sprintf("Waiting for certificates %s", strings.Join(pending, ", ")))
+	}
+	return r.updateStatus(ctx, n8n, typeCertificateReadyN8n, metav1.ConditionTrue, "Issued", "Certificates are ready")
+}
+
+// certificateReady reports whether cert-manager marked the Certificate ready
+func certificateReady(cert *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Ready" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
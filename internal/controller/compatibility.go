@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+)
+
+// n8nRelease is a parsed n8n version
+type n8nRelease struct {
+	major, minor, patch int
+}
+
+// parseN8nVersion parses versions in the format getN8nVersion returns, e.g. "1.85.3"
+func parseN8nVersion(version string) (n8nRelease, bool) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return n8nRelease{}, false
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return n8nRelease{}, false
+		}
+		numbers[i] = n
+	}
+	return n8nRelease{major: numbers[0], minor: numbers[1], patch: numbers[2]}, true
+}
+
+func (v n8nRelease) less(other n8nRelease) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	if v.minor != other.minor {
+		return v.minor < other.minor
+	}
+	return v.patch < other.patch
+}
+
+func (v n8nRelease) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// checkVersionChange validates moving an instance from one n8n version to another. It returns an error
+// for changes the operator refuses to roll out and a warning for changes it allows but that need attention.
+// Only the order of the versions and skipped major versions are checked, n8n publishes no machine-readable
+// list of releases that can't be upgraded from directly.
+func checkVersionChange(from, to string, rollback bool) (string, error) {
+	if from == "" || from == to {
+		return "", nil
+	}
+	current, ok := parseN8nVersion(from)
+	if !ok {
+		return fmt.Sprintf("cannot verify the compatibility of the upgrade from n8n %s to %s", from, to), nil
+	}
+	target, ok := parseN8nVersion(to)
+	if !ok {
+		return fmt.Sprintf("cannot verify the compatibility of the upgrade from n8n %s to %s", from, to), nil
+	}
+
+	if target.less(current) {
+		switch {
+		case target.major == current.major && target.minor == current.minor:
+			return fmt.Sprintf("downgrading n8n from %s to %s", current, target), nil
+		case rollback:
+			return fmt.Sprintf("rolling back n8n from %s to %s, database migrations applied since are not reverted", current, target), nil
+		default:
+			return "", fmt.Errorf("downgrading n8n from %s to %s is not supported, database migrations can't be reverted", current, target)
+		}
+	}
+
+	if target.major > current.major+1 {
+		return "", fmt.Errorf("upgrading n8n from %s to %s skips a major version, upgrade to %d.x first", current, target, current.major+1)
+	}
+
+	if target.major > current.major {
+		return fmt.Sprintf("upgrading n8n across major versions from %s to %s, review the breaking changes", current, target), nil
+	}
+	return "", nil
+}
+
+// upgradePolicyAllows reports whether the upgrade policy rolls out a release without approval
+func upgradePolicyAllows(policy n8nv1alpha1.UpgradePolicy, from, to string) bool {
+	current, ok := parseN8nVersion(from)
+	if !ok {
+		return false
+	}
+	target, ok := parseN8nVersion(to)
+	if !ok || !current.less(target) {
+		return false
+	}
+
+	switch policy {
+	case n8nv1alpha1.UpgradePolicyManual:
+		return false
+	case n8nv1alpha1.UpgradePolicyMinor:
+		return target.major == current.major
+	default:
+		return target.major == current.major && target.minor == current.minor
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const finalizerPollInterval = 10 * time.Second
+
+var volumeSnapshotGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+
+func deletionPolicyForN8n(n8n *n8nv1alpha1.N8n) n8nv1alpha1.DeletionPolicy {
+	if n8n.Spec.DeletionPolicy == "" {
+		return n8nv1alpha1.DeletionPolicyDelete
+	}
+	return n8n.Spec.DeletionPolicy
+}
+
+// doFinalizerOperationsForN8n applies the deletion policy before the finalizer is removed. It reports
+// whether the operations are complete, otherwise they are retried until the backup or snapshot is done.
+func (r *N8nReconciler) doFinalizerOperationsForN8n(ctx context.Context, cr *n8nv1alpha1.N8n) (bool, error) {
+	if cr.Spec.Backup != nil && cr.Spec.Backup.BeforeDeletion {
+		done, err := r.finalBackup(ctx, cr)
+		if err != nil || !done {
+			return false, err
+		}
+	}
+
+	policy := deletionPolicyForN8n(cr)
+	// Claims the operator didn't create are left alone
+	if policy == n8nv1alpha1.DeletionPolicySnapshot && managedDataClaim(cr) {
+		done, err := r.snapshotData(ctx, cr)
+		if err != nil || !done {
+			return false, err
+		}
+	}
+
+	if policy != n8nv1alpha1.DeletionPolicyDelete {
+		// Without the encryption key the credentials stored in the data are unreadable, keep them together
+		if err := r.orphan(ctx, cr, &corev1.Secret{}, encryptionKeyRef(cr).Name); err != nil {
+			return false, err
+		}
+	}
+	if policy == n8nv1alpha1.DeletionPolicyRetain && managedDataClaim(cr) {
+		if err := r.orphan(ctx, cr, &corev1.PersistentVolumeClaim{}, dataClaimName(cr)); err != nil {
+			return false, err
+		}
+	}
+
+	r.Recorder.Event(cr, "Warning", "Deleting",
+		fmt.Sprintf("Custom Resource %s is being deleted from the namespace %s",
+			cr.Name,
+			cr.Namespace))
+	return true, nil
+}
+
+// finalBackupName returns the name of the backup Job run on deletion. Like the final snapshot it carries the UID
+// of the N8n resource, since the Job isn't owned by it and may still exist when a new resource of the name is deleted.
+func finalBackupName(n8n *n8nv1alpha1.N8n) string {
+	return fmt.Sprintf("%s-final-backup-%s", n8n.Name, string(n8n.UID)[:8])
+}
+
+// finalBackup runs the backup Job taken before deletion and reports whether it finished
+func (r *N8nReconciler) finalBackup(ctx context.Context, n8n *n8nv1alpha1.N8n) (bool, error) {
+	name := finalBackupName(n8n)
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: n8n.Namespace}, job)
+	if apierrors.IsNotFound(err) {
+		job, err = r.backupJobForN8n(n8n, name, "final")
+		if err != nil {
+			return false, err
+		}
+		r.Recorder.Event(n8n, "Normal", "BackingUp", "Backing up the database before deletion")
+		return false, r.Create(ctx, job)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	finished, succeeded := jobFinished(job)
+	if finished && !succeeded {
+		// Don't block the deletion forever, the Job is left behind for inspection until its TTL expires
+		r.Recorder.Event(n8n, "Warning", "BackupFailed", fmt.Sprintf("Final backup Job %s failed", name))
+	}
+	return finished, nil
+}
+
+// finalSnapshotName returns the name of the VolumeSnapshot taken on deletion. It carries the UID of the N8n
+// resource, so a recreated resource never mistakes the snapshot left by its predecessor for its own.
+func finalSnapshotName(n8n *n8nv1alpha1.N8n) string {
+	return fmt.Sprintf("%s-final-%s", dataClaimName(n8n), string(n8n.UID)[:8])
+}
+
+// snapshotData takes a VolumeSnapshot of the data PVC and reports whether it is ready. The snapshot isn't
+// owned by the N8n resource so it outlives it. Clusters without snapshot support retain the PVC instead.
+func (r *N8nReconciler) snapshotData(ctx context.Context, n8n *n8nv1alpha1.N8n) (bool, error) {
+	log := log.FromContext(ctx)
+
+	claimName := dataClaimName(n8n)
+	if err := r.Get(ctx, types.NamespacedName{Name: claimName, Namespace: n8n.Namespace}, &corev1.PersistentVolumeClaim{}); err != nil {
+		// Nothing to snapshot without persistent storage
+		return apierrors.IsNotFound(err), client.IgnoreNotFound(err)
+	}
+
+	available, err := r.apiAvailable(volumeSnapshotGVK)
+	if err != nil {
+		return false, err
+	}
+	if !available {
+		r.Recorder.Event(n8n, "Warning", "SnapshotUnavailable",
+			fmt.Sprintf("VolumeSnapshots are not supported by the cluster, retaining PersistentVolumeClaim %s", claimName))
+		return true, r.orphan(ctx, n8n, &corev1.PersistentVolumeClaim{}, claimName)
+	}
+
+	snapshot := newUnstructured(volumeSnapshotGVK)
+	name := finalSnapshotName(n8n)
+	err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: n8n.Namespace}, snapshot)
+	if apierrors.IsNotFound(err) {
+		snapshot.SetName(name)
+		snapshot.SetNamespace(n8n.Namespace)
+		snapshot.SetLabels(labelsForN8n())
+		snapshot.Object["spec"] = map[string]interface{}{
+			"source": map[string]interface{}{
+				"persistentVolumeClaimName": claimName,
+			},
+		}
+		log.Info("Creating VolumeSnapshot of the n8n data", "VolumeSnapshot.Name", name)
+		r.Recorder.Event(n8n, "Normal", "Snapshotting", fmt.Sprintf("Taking VolumeSnapshot %s of the n8n data", name))
+		return false, r.Create(ctx, snapshot)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+		r.Recorder.Event(n8n, "Warning", "SnapshotFailed",
+			fmt.Sprintf("VolumeSnapshot %s failed, retaining PersistentVolumeClaim %s: %s", name, claimName, message))
+		return true, r.orphan(ctx, n8n, &corev1.PersistentVolumeClaim{}, claimName)
+	}
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	return ready, nil
+}
+
+// orphan removes the owner reference to the N8n resource from the named object so it isn't garbage collected
+func (r *N8nReconciler) orphan(ctx context.Context, n8n *n8nv1alpha1.N8n, obj client.Object, name string) error {
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: n8n.Namespace}, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	var refs []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID != n8n.UID {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == len(obj.GetOwnerReferences()) {
+		return nil
+	}
+	obj.SetOwnerReferences(refs)
+	if err := r.Update(ctx, obj); err != nil {
+		return err
+	}
+	r.Recorder.Event(n8n, "Normal", "Retained", fmt.Sprintf("Retaining %s", name))
+	return nil
+}
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"fmt"
+
 	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -8,31 +10,61 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
-func (r *N8nReconciler) deploymentForN8n(n8n *n8nv1alpha1.N8n) (*appsv1.Deployment, error) {
+const (
+	defaultPermissionsImage = "busybox:1.37.0"
+	n8nContainerPort        = 5678
+)
+
+// n8nWritableVolumes names the volumes n8n writes to when its root filesystem is read-only
+var n8nWritableVolumes = []string{"tmp", "cache", "n8n-home"}
+
+// maxReplicasForN8n returns the highest number of n8n pods, the main instance and the queue mode
+// workers, that may run at the same time
+func maxReplicasForN8n(n8n *n8nv1alpha1.N8n) int32 {
+	if queueModeEnabled(n8n) {
+		return 1 + n8n.Spec.Autoscaling.MaxReplicas
+	}
+	return 1
+}
+
+func (r *N8nReconciler) deploymentForN8n(n8n *n8nv1alpha1.N8n, urls n8nURLs, encryptionKeyFromSecret bool) (*appsv1.Deployment, error) {
 	ls := labelsForN8n()
-	replicas := int32(1)
-	image := n8nDockerImage
+	ls[instanceLabel] = n8n.Name
+	replicas := replicasForN8n(n8n)
+	version := imageVersionForN8n(n8n)
+	image := n8nImage(version)
 	var volumes []corev1.Volume
 	var volumeMounts []corev1.VolumeMount
 
-	if n8n.Spec.PersistentStorage != nil && n8n.Spec.PersistentStorage.Enable {
+	if persistentStorageEnabled(n8n) {
 		volumes = append(volumes, corev1.Volume{
-			Name: "n8n-data",
-			VolumeSource: corev1.VolumeSource{
-				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-					ClaimName: n8n.Name + "-data",
-				},
-			},
+			Name:         "n8n-data",
+			VolumeSource: dataVolumeSource(n8n),
 		})
 		volumeMounts = append(volumeMounts, corev1.VolumeMount{
 			Name:      "n8n-data",
 			MountPath: "/home/node/.n8n",
 		})
+	}
 
-		if err := r.createPVCIfNotExists(n8n); err != nil {
-			return nil, err
-		}
+	extraVolumes, extraVolumeMounts := externalSecretsVolumes(n8n)
+	volumes = append(volumes, extraVolumes...)
+	containerVolumeMounts := append(append([]corev1.VolumeMount{}, volumeMounts...), extraVolumeMounts...)
+
+	certVolumes, certMounts := servingCertVolumes(n8n)
+	volumes = append(volumes, certVolumes...)
+	containerVolumeMounts = append(containerVolumeMounts, certMounts...)
+
+	writablePaths := map[string]string{
+		"tmp":   "/tmp",
+		"cache": "/home/node/.cache",
+	}
+	if !persistentStorageEnabled(n8n) {
+		writablePaths["n8n-home"] = "/home/node/.n8n"
 	}
+	writable, writableMounts := writableVolumes(n8n, writablePaths)
+	volumes = append(volumes, writable...)
+	containerVolumeMounts = append(containerVolumeMounts, writableMounts...)
 
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -41,49 +73,35 @@ func (r *N8nReconciler) deploymentForN8n(n8n *n8nv1alpha1.N8n) (*appsv1.Deployme
 			Labels: map[string]string{
 				"app.kubernetes.io/name":    "n8n",
 				"app":                       "n8n",
-				"app.kubernetes.io/version": n8nVersion,
-				"version":                   n8nVersion,
+				"app.kubernetes.io/version": version,
+				"version":                   version,
 			},
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: &replicas,
+			Replicas: replicas,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: ls,
+				MatchLabels: instanceLabelsForN8n(n8n),
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: ls,
 				},
 				Spec: corev1.PodSpec{
-					SecurityContext: getPodSecurityContext(),
+					SecurityContext: getPodSecurityContext(n8n),
 					Volumes:         volumes,
-					InitContainers: []corev1.Container{{
-						Name:            "init-permissions",
-						Image:           "busybox",
-						ImagePullPolicy: corev1.PullIfNotPresent,
-						Command: []string{
-							"sh",
-							"-c",
-							"chown -R 1000:1000 /home/node/.n8n",
-						},
-						SecurityContext: &corev1.SecurityContext{
-							RunAsUser:    &[]int64{0}[0], // Run as root to change ownership
-							RunAsNonRoot: &[]bool{false}[0],
-						},
-						VolumeMounts: volumeMounts,
-					}},
+					InitContainers:  initContainersForN8n(n8n, volumeMounts),
 					Containers: []corev1.Container{{
 						Image:           image,
 						Name:            "n8n",
 						ImagePullPolicy: corev1.PullIfNotPresent,
-						SecurityContext: getContainerSecurityContext(),
+						SecurityContext: getContainerSecurityContext(n8n),
 						Ports: []corev1.ContainerPort{{
-							ContainerPort: 5678,
+							ContainerPort: n8nContainerPort,
 							Name:          "http",
 						}},
 						Command:      []string{"tini", "--", "/docker-entrypoint.sh"},
-						Env:          getN8nEnvVars(n8n),
-						VolumeMounts: volumeMounts,
+						Env:          getN8nEnvVars(n8n, urls, encryptionKeyFromSecret),
+						VolumeMounts: containerVolumeMounts,
 					}},
 				},
 			},
@@ -94,3 +112,43 @@ func (r *N8nReconciler) deploymentForN8n(n8n *n8nv1alpha1.N8n) (*appsv1.Deployme
 	}
 	return dep, nil
 }
+
+// initContainersForN8n returns the init container fixing the ownership of the data volume when requested.
+// Otherwise the pod fsGroup makes the volume writable for n8n.
+func initContainersForN8n(n8n *n8nv1alpha1.N8n, volumeMounts []corev1.VolumeMount) []corev1.Container {
+	if !persistentStorageEnabled(n8n) || n8n.Spec.Storage == nil || !n8n.Spec.Storage.FixPermissions {
+		return nil
+	}
+
+	image := n8n.Spec.Storage.Image
+	if image == "" {
+		image = defaultPermissionsImage
+	}
+	uid, gid := int64(defaultUserID), int64(defaultGroupID)
+	if id := getContainerSecurityContext(n8n).RunAsUser; id != nil {
+		uid = *id
+	}
+	if id := getPodSecurityContext(n8n).FSGroup; id != nil {
+		gid = *id
+	}
+	return []corev1.Container{{
+		Name:            "init-permissions",
+		Image:           image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command: []string{
+			"sh",
+			"-c",
+			fmt.Sprintf("chown -R %d:%d /home/node/.n8n", uid, gid),
+		},
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:                &[]int64{0}[0], // Run as root to change ownership
+			RunAsNonRoot:             &[]bool{false}[0],
+			AllowPrivilegeEscalation: &[]bool{false}[0],
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+				Add:  []corev1.Capability{"CHOWN", "DAC_OVERRIDE", "FOWNER"},
+			},
+		},
+		VolumeMounts: volumeMounts,
+	}}
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podDisruptionBudgetWanted reports whether the n8n pods should be protected by a PodDisruptionBudget
+func podDisruptionBudgetWanted(n8n *n8nv1alpha1.N8n) bool {
+	if n8n.Spec.Disruption != nil && n8n.Spec.Disruption.Enable != nil {
+		return *n8n.Spec.Disruption.Enable
+	}
+	// A budget on a single pod would either block node drains or protect nothing
+	return queueModeEnabled(n8n) && n8n.Spec.Autoscaling.MaxReplicas > 1
+}
+
+// podDisruptionBudgetSelector returns the pods the budget protects, the workers in queue mode
+func podDisruptionBudgetSelector(n8n *n8nv1alpha1.N8n) map[string]string {
+	if queueModeEnabled(n8n) {
+		return workerLabels(n8n)
+	}
+	return instanceLabelsForN8n(n8n)
+}
+
+func (r *N8nReconciler) podDisruptionBudgetForN8n(n8n *n8nv1alpha1.N8n) (*policyv1.PodDisruptionBudget, error) {
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n8n.Name,
+			Namespace: n8n.Namespace,
+			Labels:    labelsForN8n(),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: podDisruptionBudgetSelector(n8n),
+			},
+		},
+	}
+
+	switch {
+	case n8n.Spec.Disruption != nil && n8n.Spec.Disruption.MinAvailable != nil:
+		pdb.Spec.MinAvailable = n8n.Spec.Disruption.MinAvailable
+	case n8n.Spec.Disruption != nil && n8n.Spec.Disruption.MaxUnavailable != nil:
+		pdb.Spec.MaxUnavailable = n8n.Spec.Disruption.MaxUnavailable
+	default:
+		maxUnavailable := intstr.FromInt32(1)
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	}
+
+	if err := ctrl.SetControllerReference(n8n, pdb, r.Scheme); err != nil {
+		return nil, err
+	}
+	return pdb, nil
+}
+
+// createOrUpdatePodDisruptionBudget handles the PodDisruptionBudget reconciliation
+func (r *N8nReconciler) createOrUpdatePodDisruptionBudget(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	if !podDisruptionBudgetWanted(n8n) {
+		return r.deleteIfExists(ctx, n8n, &policyv1.PodDisruptionBudget{})
+	}
+
+	pdb, err := r.podDisruptionBudgetForN8n(n8n)
+	if err != nil {
+		return err
+	}
+	return r.createOrUpdateSpec(ctx, pdb, &policyv1.PodDisruptionBudget{}, func(existing client.Object) bool {
+		current := existing.(*policyv1.PodDisruptionBudget)
+		if reflect.DeepEqual(current.Spec.MinAvailable, pdb.Spec.MinAvailable) &&
+			reflect.DeepEqual(current.Spec.MaxUnavailable, pdb.Spec.MaxUnavailable) &&
+			reflect.DeepEqual(current.Spec.Selector, pdb.Spec.Selector) {
+			return false
+		}
+		current.Spec.MinAvailable = pdb.Spec.MinAvailable
+		current.Spec.MaxUnavailable = pdb.Spec.MaxUnavailable
+		current.Spec.Selector = pdb.Spec.Selector
+		return true
+	})
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getSMTPEnvVars returns the environment variables configuring n8n user management emails
+func getSMTPEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
+	smtp := n8n.Spec.SMTP
+	if smtp == nil || !smtp.Enable {
+		return nil
+	}
+
+	envVars := []corev1.EnvVar{
+		{
+			Name:  "N8N_EMAIL_MODE",
+			Value: "smtp",
+		},
+		{
+			Name:  "N8N_SMTP_HOST",
+			Value: smtp.Host,
+		},
+		{
+			Name:  "N8N_SMTP_PORT",
+			Value: fmt.Sprintf("%d", smtp.Port),
+		},
+		{
+			Name:  "N8N_SMTP_SENDER",
+			Value: smtp.Sender,
+		},
+		{
+			Name:  "N8N_SMTP_SSL",
+			Value: fmt.Sprintf("%t", smtp.SSL),
+		},
+	}
+
+	if smtp.StartTLS != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "N8N_SMTP_STARTTLS",
+			Value: fmt.Sprintf("%t", *smtp.StartTLS),
+		})
+	}
+
+	if smtp.CredentialsSecret != nil {
+		envVars = append(envVars,
+			secretEnvVar("N8N_SMTP_USER", smtp.CredentialsSecret.Name, smtp.CredentialsSecret.UserKey),
+			secretEnvVar("N8N_SMTP_PASS", smtp.CredentialsSecret.Name, smtp.CredentialsSecret.PasswordKey),
+		)
+	}
+
+	return envVars
+}
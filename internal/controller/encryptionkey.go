@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	encryptionKeySecretKey     = "encryptionKey"
+	encryptionKeyEnvVar        = "N8N_ENCRYPTION_KEY"
+	reasonEncryptionKeyMissing = "EncryptionKeyMissing"
+)
+
+// encryptionKeyMissingError reports that the encryption key an instance was started with is gone
+type encryptionKeyMissingError struct {
+	message string
+}
+
+func (e *encryptionKeyMissingError) Error() string {
+	return e.message
+}
+
+// encryptionKeyRef returns the Secret key holding the n8n encryption key
+func encryptionKeyRef(n8n *n8nv1alpha1.N8n) n8nv1alpha1.SecretKeyRef {
+	if n8n.Spec.EncryptionKeySecret != nil {
+		return *n8n.Spec.EncryptionKeySecret
+	}
+	return n8nv1alpha1.SecretKeyRef{Name: n8n.Name + "-encryption-key", Key: encryptionKeySecretKey}
+}
+
+// getEncryptionKeyEnvVars returns the environment variable passing the encryption key to n8n
+func getEncryptionKeyEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
+	ref := encryptionKeyRef(n8n)
+	return []corev1.EnvVar{secretEnvVar(encryptionKeyEnvVar, ref.Name, ref.Key)}
+}
+
+// readsEncryptionKey reports whether the n8n container of the Deployment reads the encryption key from a Secret
+func readsEncryptionKey(dep *appsv1.Deployment) bool {
+	container := n8nContainer(dep)
+	return container != nil && slices.ContainsFunc(container.Env, func(env corev1.EnvVar) bool {
+		return env.Name == encryptionKeyEnvVar
+	})
+}
+
+// reconcileEncryptionKey makes sure the encryption key exists and reports whether n8n reads it from the
+// Secret. A key is only generated for new instances: instances that already wrote data without the Secret
+// keep the key n8n generated in its user folder, and a key that went missing is never replaced since the
+// credentials encrypted with it would become unreadable.
+func (r *N8nReconciler) reconcileEncryptionKey(ctx context.Context, n8n *n8nv1alpha1.N8n) (bool, error) {
+	ref := encryptionKeyRef(n8n)
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: n8n.Namespace}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	secretFound := err == nil
+
+	dep := &appsv1.Deployment{}
+	err = r.Get(ctx, types.NamespacedName{Name: n8n.Name, Namespace: n8n.Namespace}, dep)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	deploymentFound := err == nil
+	explicit := n8n.Spec.EncryptionKeySecret != nil
+
+	if secretFound {
+		if _, ok := secret.Data[ref.Key]; !ok {
+			return false, &encryptionKeyMissingError{
+				message: fmt.Sprintf("Secret %s does not contain the encryption key %s", ref.Name, ref.Key),
+			}
+		}
+		// Without a referenced Secret, an instance running on its own key keeps it
+		if deploymentFound && !readsEncryptionKey(dep) && !explicit {
+			return false, nil
+		}
+		return true, nil
+	}
+
+	if explicit || (deploymentFound && readsEncryptionKey(dep)) {
+		return false, &encryptionKeyMissingError{
+			message: fmt.Sprintf("Encryption key Secret %s is missing, restore it since n8n can't decrypt "+
+				"the stored credentials with a new key", ref.Name),
+		}
+	}
+	hasData, err := r.hasData(ctx, n8n, deploymentFound)
+	if err != nil || hasData {
+		return false, err
+	}
+
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return false, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ref.Name,
+			Namespace: n8n.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			ref.Key: []byte(base64.StdEncoding.EncodeToString(key)),
+		},
+	}
+	if err := ctrl.SetControllerReference(n8n, secret, r.Scheme); err != nil {
+		return false, err
+	}
+	if err := r.Create(ctx, secret); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// hasData reports whether n8n may already have written data with a key it generated itself
+func (r *N8nReconciler) hasData(ctx context.Context, n8n *n8nv1alpha1.N8n, deploymentFound bool) (bool, error) {
+	if deploymentFound {
+		return true, nil
+	}
+	if !managedDataClaim(n8n) {
+		return false, nil
+	}
+	err := r.Get(ctx, types.NamespacedName{Name: dataClaimName(n8n), Namespace: n8n.Namespace}, &corev1.PersistentVolumeClaim{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
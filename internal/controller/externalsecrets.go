@@ -0,0 +1,329 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	typeExternalSecretsReadyN8n  = "ExternalSecretsReady"
+	externalSecretsVolumeName    = "external-secrets"
+	externalSecretsMountPath     = "/etc/n8n/external-secrets"
+	vaultCACertFileName          = "vault-ca.crt"
+	externalSecretsRetryInterval = 30 * time.Second
+)
+
+func externalSecretsEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.ExternalSecrets != nil && n8n.Spec.ExternalSecrets.Enable
+}
+
+// getExternalSecretsEnvVars returns the environment variables n8n reads for external secrets. The provider
+// itself is configured through the n8n API, see reconcileExternalSecrets.
+func getExternalSecretsEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
+	if !externalSecretsEnabled(n8n) {
+		return nil
+	}
+
+	es := n8n.Spec.ExternalSecrets
+	envVars := []corev1.EnvVar{
+		{
+			Name:  "N8N_EXTERNAL_SECRETS_UPDATE_INTERVAL",
+			Value: fmt.Sprintf("%d", es.UpdateInterval),
+		},
+	}
+	// n8n connects to Vault with the Node.js HTTP client, which trusts the extra CAs
+	if es.Provider == n8nv1alpha1.ExternalSecretsProviderVault && es.Vault != nil && es.Vault.CACertSecret != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "NODE_EXTRA_CA_CERTS",
+			Value: path.Join(externalSecretsMountPath, vaultCACertFileName),
+		})
+	}
+	return envVars
+}
+
+// externalSecretsVolumes returns the volumes and mounts holding provider auth material
+func externalSecretsVolumes(n8n *n8nv1alpha1.N8n) ([]corev1.Volume, []corev1.VolumeMount) {
+	if !externalSecretsEnabled(n8n) ||
+		n8n.Spec.ExternalSecrets.Provider != n8nv1alpha1.ExternalSecretsProviderVault ||
+		n8n.Spec.ExternalSecrets.Vault == nil ||
+		n8n.Spec.ExternalSecrets.Vault.CACertSecret == nil {
+		return nil, nil
+	}
+
+	ca := n8n.Spec.ExternalSecrets.Vault.CACertSecret
+	volumes := []corev1.Volume{{
+		Name: externalSecretsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: ca.Name,
+				Items: []corev1.KeyToPath{{
+					Key:  ca.Key,
+					Path: vaultCACertFileName,
+				}},
+			},
+		},
+	}}
+	mounts := []corev1.VolumeMount{{
+		Name:      externalSecretsVolumeName,
+		MountPath: externalSecretsMountPath,
+		ReadOnly:  true,
+	}}
+	return volumes, mounts
+}
+
+// externalSecretRefs returns every Secret key the provider configuration depends on
+func externalSecretRefs(n8n *n8nv1alpha1.N8n) []n8nv1alpha1.SecretKeyRef {
+	es := n8n.Spec.ExternalSecrets
+	var refs []n8nv1alpha1.SecretKeyRef
+	switch es.Provider {
+	case n8nv1alpha1.ExternalSecretsProviderVault:
+		if es.Vault != nil {
+			refs = append(refs, es.Vault.TokenSecret)
+			if es.Vault.CACertSecret != nil {
+				refs = append(refs, *es.Vault.CACertSecret)
+			}
+		}
+	case n8nv1alpha1.ExternalSecretsProviderAWSSecretsManager:
+		if es.AWSSecretsManager != nil && es.AWSSecretsManager.CredentialsSecret != nil {
+			creds := es.AWSSecretsManager.CredentialsSecret
+			refs = append(refs,
+				n8nv1alpha1.SecretKeyRef{Name: creds.Name, Key: creds.AccessKeyIDKey},
+				n8nv1alpha1.SecretKeyRef{Name: creds.Name, Key: creds.SecretAccessKeyKey},
+			)
+		}
+	case n8nv1alpha1.ExternalSecretsProviderInfisical:
+		if es.Infisical != nil {
+			refs = append(refs, es.Infisical.TokenSecret)
+		}
+	}
+	return refs
+}
+
+// externalSecretsSettings returns the provider settings in the form the n8n API stores them
+func (r *N8nReconciler) externalSecretsSettings(ctx context.Context, n8n *n8nv1alpha1.N8n) (map[string]interface{}, error) {
+	es := n8n.Spec.ExternalSecrets
+	switch es.Provider {
+	case n8nv1alpha1.ExternalSecretsProviderVault:
+		token, err := r.secretValue(ctx, n8n.Namespace, es.Vault.TokenSecret.Name, es.Vault.TokenSecret.Key)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"url":        es.Vault.URL,
+			"namespace":  es.Vault.Namespace,
+			"authMethod": "token",
+			"token":      token,
+		}, nil
+	case n8nv1alpha1.ExternalSecretsProviderAWSSecretsManager:
+		settings := map[string]interface{}{
+			"region":     es.AWSSecretsManager.Region,
+			"authMethod": "autoDetect",
+		}
+		if creds := es.AWSSecretsManager.CredentialsSecret; creds != nil {
+			accessKeyID, err := r.secretValue(ctx, n8n.Namespace, creds.Name, creds.AccessKeyIDKey)
+			if err != nil {
+				return nil, err
+			}
+			secretAccessKey, err := r.secretValue(ctx, n8n.Namespace, creds.Name, creds.SecretAccessKeyKey)
+			if err != nil {
+				return nil, err
+			}
+			settings["authMethod"] = "iamUser"
+			settings["accessKeyId"] = accessKeyID
+			settings["secretAccessKey"] = secretAccessKey
+		}
+		return settings, nil
+	case n8nv1alpha1.ExternalSecretsProviderInfisical:
+		token, err := r.secretValue(ctx, n8n.Namespace, es.Infisical.TokenSecret.Name, es.Infisical.TokenSecret.Key)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"siteURL": es.Infisical.SiteURL,
+			"token":   token,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported external secrets provider %q", es.Provider)
+}
+
+// testExternalSecretsProvider asks n8n to connect to the provider with the settings, and returns why it failed
+func (c *n8nAPIClient) testExternalSecretsProvider(ctx context.Context, provider string, settings map[string]interface{}) (bool, string, error) {
+	result := &struct {
+		Data struct {
+			Success bool   `json:"success"`
+			Error   string `json:"error"`
+		} `json:"data"`
+	}{}
+	_, err := c.do(ctx, http.MethodPost, "/rest/external-secrets/providers/"+provider+"/test", settings, result)
+	var apiErr *n8nAPIError
+	// n8n answers failed connection tests with a bad request carrying the result
+	if errors.As(err, &apiErr) && apiErr.statusCode == http.StatusBadRequest {
+		_ = json.Unmarshal(apiErr.body, result)
+		if result.Data.Error == "" {
+			result.Data.Error = fmt.Sprintf("n8n could not connect to %s", provider)
+		}
+		return false, result.Data.Error, nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return result.Data.Success, result.Data.Error, nil
+}
+
+// disconnectExternalSecretsProviders disconnects the connected providers other than keep
+func (c *n8nAPIClient) disconnectExternalSecretsProviders(ctx context.Context, keep string) error {
+	providers := &struct {
+		Data []struct {
+			Name      string `json:"name"`
+			Connected bool   `json:"connected"`
+		} `json:"data"`
+	}{}
+	if _, err := c.do(ctx, http.MethodGet, "/rest/external-secrets/providers", nil, providers); err != nil {
+		return err
+	}
+	for _, provider := range providers.Data {
+		if !provider.Connected || provider.Name == keep {
+			continue
+		}
+		if _, err := c.do(ctx, http.MethodPost, "/rest/external-secrets/providers/"+provider.Name+"/connect",
+			map[string]bool{"connected": false}, nil); err != nil {
+			return fmt.Errorf("failed to disconnect external secrets provider %s: %w", provider.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyExternalSecrets tests the provider settings in n8n, then saves them and connects the provider in
+// place of any other. It returns why n8n could not connect, empty once the provider is connected.
+func (r *N8nReconciler) applyExternalSecrets(ctx context.Context, n8n *n8nv1alpha1.N8n, client *n8nAPIClient) (string, error) {
+	settings, err := r.externalSecretsSettings(ctx, n8n)
+	if err != nil {
+		return "", err
+	}
+
+	provider := string(n8n.Spec.ExternalSecrets.Provider)
+	connected, message, err := client.testExternalSecretsProvider(ctx, provider, settings)
+	if err != nil {
+		return "", fmt.Errorf("failed to test external secrets provider %s: %w", provider, err)
+	}
+	if !connected {
+		return message, nil
+	}
+
+	providerPath := "/rest/external-secrets/providers/" + provider
+	if _, err := client.do(ctx, http.MethodPost, providerPath, settings, nil); err != nil {
+		return "", fmt.Errorf("failed to save external secrets provider %s: %w", provider, err)
+	}
+	if err := client.disconnectExternalSecretsProviders(ctx, provider); err != nil {
+		return "", err
+	}
+	if _, err := client.do(ctx, http.MethodPost, providerPath+"/connect", map[string]bool{"connected": true}, nil); err != nil {
+		return "", fmt.Errorf("failed to connect external secrets provider %s: %w", provider, err)
+	}
+	return "", nil
+}
+
+// reconcileExternalSecrets configures the external secrets provider through the n8n API and reports
+// whether n8n connected to it
+func (r *N8nReconciler) reconcileExternalSecrets(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	if !externalSecretsEnabled(n8n) {
+		return r.removeExternalSecrets(ctx, n8n)
+	}
+
+	var referenced []client.Object
+	for _, ref := range externalSecretRefs(n8n) {
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: n8n.Namespace}, secret)
+		if apierrors.IsNotFound(err) {
+			return r.updateStatus(ctx, n8n, typeExternalSecretsReadyN8n, metav1.ConditionFalse, "SecretNotFound",
+				fmt.Sprintf("Secret %s referenced by the external secrets provider was not found", ref.Name))
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := secret.Data[ref.Key]; !ok {
+			return r.updateStatus(ctx, n8n, typeExternalSecretsReadyN8n, metav1.ConditionFalse, "SecretKeyNotFound",
+				fmt.Sprintf("Secret %s does not contain key %s", ref.Name, ref.Key))
+		}
+		referenced = append(referenced, secret)
+	}
+
+	// Settings are applied again when they or the Secrets they are read from change
+	hash := appliedConfigHash(n8n.Spec.ExternalSecrets, referenced)
+	if hash == n8n.Status.ExternalSecretsConfigHash &&
+		meta.IsStatusConditionTrue(n8n.Status.Conditions, typeExternalSecretsReadyN8n) {
+		return nil
+	}
+
+	available, err := r.n8nAvailable(ctx, n8n)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return r.updateStatus(ctx, n8n, typeExternalSecretsReadyN8n, metav1.ConditionUnknown, "WaitingForN8n",
+			"Waiting for n8n to become available before configuring the external secrets provider")
+	}
+
+	apiClient, err := r.ownerClient(ctx, n8n, n8nServiceURL(n8n))
+	var message string
+	if err == nil {
+		message, err = r.applyExternalSecrets(ctx, n8n, apiClient)
+	}
+	if err != nil {
+		if err := r.updateStatus(ctx, n8n, typeExternalSecretsReadyN8n, metav1.ConditionFalse, "ApplyFailed",
+			fmt.Sprintf("Failed to configure the external secrets provider: %v", err)); err != nil {
+			return err
+		}
+		// Returning the error retries with backoff
+		return fmt.Errorf("failed to configure the external secrets provider: %w", err)
+	}
+	if message != "" {
+		return r.updateStatus(ctx, n8n, typeExternalSecretsReadyN8n, metav1.ConditionFalse, "ConnectionFailed",
+			fmt.Sprintf("n8n could not connect to %s: %s", n8n.Spec.ExternalSecrets.Provider, message))
+	}
+
+	n8n.Status.ExternalSecretsConfigHash = hash
+	return r.updateStatus(ctx, n8n, typeExternalSecretsReadyN8n, metav1.ConditionTrue, "Connected",
+		fmt.Sprintf("n8n is connected to external secrets provider %s", n8n.Spec.ExternalSecrets.Provider))
+}
+
+// removeExternalSecrets disconnects the provider the operator connected once external secrets are disabled
+func (r *N8nReconciler) removeExternalSecrets(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	if meta.FindStatusCondition(n8n.Status.Conditions, typeExternalSecretsReadyN8n) == nil {
+		return nil
+	}
+
+	if n8n.Status.ExternalSecretsConfigHash != "" {
+		available, err := r.n8nAvailable(ctx, n8n)
+		if err != nil {
+			return err
+		}
+		if available {
+			apiClient, err := r.ownerClient(ctx, n8n, n8nServiceURL(n8n))
+			if err == nil {
+				err = apiClient.disconnectExternalSecretsProviders(ctx, "")
+			}
+			if err != nil {
+				log.FromContext(ctx).Info("Unable to disconnect the external secrets provider", "error", err.Error())
+			}
+		}
+	}
+
+	meta.RemoveStatusCondition(&n8n.Status.Conditions, typeExternalSecretsReadyN8n)
+	n8n.Status.ExternalSecretsConfigHash = ""
+	return r.Status().Update(ctx, n8n)
+}
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+var httpRouteGVK = gatewayv1.SchemeGroupVersion.WithKind("HTTPRoute")
+
+const (
+	typeHTTPRouteAcceptedN8n   = "HTTPRouteAccepted"
+	typeHTTPRouteProgrammedN8n = "HTTPRouteProgrammed"
+	httpRoutePollInterval      = 15 * time.Second
+)
+
+func httpRouteEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.HTTPRoute != nil && n8n.Spec.HTTPRoute.Enable
+}
+
+// gatewayRefsForEndpoint returns the Gateways the HTTPRoute of the endpoint attaches to, the
+// endpoint's own Gateway first
+func gatewayRefsForEndpoint(n8n *n8nv1alpha1.N8n, endpoint n8nEndpoint) []n8nv1alpha1.GatewayRef {
+	ref := n8n.Spec.HTTPRoute.GatewayRef
+	if endpoint.gatewayRef != nil {
+		ref = *endpoint.gatewayRef
+	}
+	if ref.Namespace == "" {
+		ref.Namespace = n8n.Namespace
+	}
+	refs := []n8nv1alpha1.GatewayRef{ref}
+	for _, additional := range n8n.Spec.HTTPRoute.AdditionalGatewayRefs {
+		if additional.Namespace == "" {
+			additional.Namespace = n8n.Namespace
+		}
+		refs = append(refs, additional)
+	}
+	return refs
+}
+
+// parentRefForGateway returns the HTTPRoute parent reference to the Gateway, with the group and
+// kind the API server would default so that comparing the spec doesn't detect spurious changes
+func parentRefForGateway(ref n8nv1alpha1.GatewayRef) gatewayv1.ParentReference {
+	group := gatewayv1.Group(gatewayv1.GroupName)
+	kind := gatewayv1.Kind("Gateway")
+	namespace := gatewayv1.Namespace(ref.Namespace)
+	parent := gatewayv1.ParentReference{
+		Group:     &group,
+		Kind:      &kind,
+		Namespace: &namespace,
+		Name:      gatewayv1.ObjectName(ref.Name),
+	}
+	if ref.SectionName != "" {
+		sectionName := gatewayv1.SectionName(ref.SectionName)
+		parent.SectionName = &sectionName
+	}
+	if ref.Port != nil {
+		port := gatewayv1.PortNumber(*ref.Port)
+		parent.Port = &port
+	}
+	return parent
+}
+
+// sameParent reports whether a parent reference reported in the HTTPRoute status is the given one
+func sameParent(reported, parent gatewayv1.ParentReference, routeNamespace string) bool {
+	namespace := routeNamespace
+	if reported.Namespace != nil {
+		namespace = string(*reported.Namespace)
+	}
+	return reported.Name == parent.Name &&
+		namespace == string(*parent.Namespace) &&
+		ptrValue(reported.SectionName) == ptrValue(parent.SectionName) &&
+		ptrValue(reported.Port) == ptrValue(parent.Port)
+}
+
+func ptrValue[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+// reconcileHTTPRouteStatus reports whether the Gateways accepted the HTTPRoutes and programmed the
+// listeners they attach to
+func (r *N8nReconciler) reconcileHTTPRouteStatus(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	if !httpRouteEnabled(n8n) {
+		changed := false
+		for _, conditionType := range []string{typeHTTPRouteAcceptedN8n, typeHTTPRouteProgrammedN8n} {
+			if meta.FindStatusCondition(n8n.Status.Conditions, conditionType) != nil {
+				meta.RemoveStatusCondition(&n8n.Status.Conditions, conditionType)
+				changed = true
+			}
+		}
+		if changed {
+			return r.Status().Update(ctx, n8n)
+		}
+		return nil
+	}
+
+	var notAccepted, notProgrammed []string
+	acceptedReason, programmedReason := "Pending", "NotProgrammed"
+	checkedGateways := map[types.NamespacedName]bool{}
+	for _, endpoint := range endpointsForN8n(n8n) {
+		route := &gatewayv1.HTTPRoute{}
+		err := r.Get(ctx, types.NamespacedName{Name: endpoint.name, Namespace: n8n.Namespace}, route)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		for _, ref := range gatewayRefsForEndpoint(n8n, endpoint) {
+			parent := parentRefForGateway(ref)
+			gatewayName := fmt.Sprintf("%s/%s", ref.Namespace, ref.Name)
+			if ref.SectionName != "" {
+				gatewayName += "/" + ref.SectionName
+			}
+
+			var status *gatewayv1.RouteParentStatus
+			for i := range route.Status.Parents {
+				if sameParent(route.Status.Parents[i].ParentRef, parent, n8n.Namespace) {
+					status = &route.Status.Parents[i]
+				}
+			}
+			switch {
+			case status == nil:
+				notAccepted = append(notAccepted, fmt.Sprintf("%s: no status reported by %s", endpoint.name, gatewayName))
+			case !meta.IsStatusConditionTrue(status.Conditions, string(gatewayv1.RouteConditionAccepted)):
+				acceptedReason = "NotAccepted"
+				notAccepted = append(notAccepted, routeConditionMessage(endpoint.name, gatewayName, status,
+					gatewayv1.RouteConditionAccepted))
+			case meta.IsStatusConditionFalse(status.Conditions, string(gatewayv1.RouteConditionResolvedRefs)):
+				acceptedReason = "RefsNotResolved"
+				notAccepted = append(notAccepted, routeConditionMessage(endpoint.name, gatewayName, status,
+					gatewayv1.RouteConditionResolvedRefs))
+			}
+
+			key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+			if checkedGateways[key] {
+				continue
+			}
+			checkedGateways[key] = true
+			gateway := &gatewayv1.Gateway{}
+			if err := r.Get(ctx, key, gateway); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return err
+				}
+				programmedReason = "GatewayNotFound"
+				notProgrammed = append(notProgrammed, fmt.Sprintf("gateway %s/%s not found", ref.Namespace, ref.Name))
+				continue
+			}
+			if !meta.IsStatusConditionTrue(gateway.Status.Conditions, string(gatewayv1.GatewayConditionProgrammed)) {
+				notProgrammed = append(notProgrammed, fmt.Sprintf("gateway %s/%s is not programmed", ref.Namespace, ref.Name))
+			}
+		}
+	}
+
+	if len(notAccepted) > 0 {
+		if err := r.updateStatus(ctx, n8n, typeHTTPRouteAcceptedN8n, metav1.ConditionFalse, acceptedReason,
+			strings.Join(notAccepted, "; ")); err != nil {
+			return err
+		}
+	} else if err := r.updateStatus(ctx, n8n, typeHTTPRouteAcceptedN8n, metav1.ConditionTrue, "Accepted",
+		"HTTPRoutes are accepted by their gateways"); err != nil {
+		return err
+	}
+
+	if len(notProgrammed) > 0 {
+		return r.updateStatus(ctx, n8n, typeHTTPRouteProgrammedN8n, metav1.ConditionFalse, programmedReason,
+			strings.Join(notProgrammed, "; "))
+	}
+	return r.updateStatus(ctx, n8n, typeHTTPRouteProgrammedN8n, metav1.ConditionTrue, "Programmed",
+		"Gateways of the HTTPRoutes are programmed")
+}
+
+// routeConditionMessage describes why a route condition reported by the gateway isn't true
+func routeConditionMessage(route, gateway string, status *gatewayv1.RouteParentStatus,
+	conditionType gatewayv1.RouteConditionType) string {
+	message := fmt.Sprintf("%s: %s not %s", route, gateway, strings.ToLower(string(conditionType)))
+	if condition := meta.FindStatusCondition(status.Conditions, string(conditionType)); condition != nil {
+		message = fmt.Sprintf("%s: %s on %s", route, condition.Message, gateway)
+		if condition.Message == "" {
+			message = fmt.Sprintf("%s: %s on %s", route, condition.Reason, gateway)
+		}
+	}
+	return message
+}
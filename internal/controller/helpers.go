@@ -2,9 +2,12 @@ package controller
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 
 	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 )
 
 const (
@@ -12,31 +15,134 @@ const (
 	defaultGroupID = 1000
 )
 
-func getPodSecurityContext() *corev1.PodSecurityContext {
-	return &corev1.PodSecurityContext{
+func getPodSecurityContext(n8n *n8nv1alpha1.N8n) *corev1.PodSecurityContext {
+	security := n8n.Spec.Security
+	if security != nil && security.PodSecurityContext != nil {
+		return security.PodSecurityContext.DeepCopy()
+	}
+
+	ctx := &corev1.PodSecurityContext{
 		RunAsNonRoot: &[]bool{true}[0],
 		SeccompProfile: &corev1.SeccompProfile{
 			Type: corev1.SeccompProfileTypeRuntimeDefault,
 		},
-		FSGroup: &[]int64{defaultGroupID}[0],
+		FSGroupChangePolicy: &[]corev1.PodFSGroupChangePolicy{corev1.FSGroupChangeOnRootMismatch}[0],
+	}
+	// OpenShift assigns the IDs from the namespace range and rejects others
+	if security == nil || !security.OpenShift {
+		ctx.FSGroup = &[]int64{defaultGroupID}[0]
+	}
+	return ctx
+}
+
+func getContainerSecurityContext(n8n *n8nv1alpha1.N8n) *corev1.SecurityContext {
+	security := n8n.Spec.Security
+	var ctx *corev1.SecurityContext
+	if security != nil && security.ContainerSecurityContext != nil {
+		ctx = security.ContainerSecurityContext.DeepCopy()
+	} else {
+		ctx = &corev1.SecurityContext{
+			RunAsNonRoot:             &[]bool{true}[0],
+			AllowPrivilegeEscalation: &[]bool{false}[0],
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{
+					"ALL",
+				},
+			},
+		}
+		if security == nil || !security.OpenShift {
+			ctx.RunAsUser = &[]int64{defaultUserID}[0]
+		}
+	}
+
+	if readOnlyRootFilesystem(n8n) {
+		ctx.ReadOnlyRootFilesystem = &[]bool{true}[0]
+	}
+	return ctx
+}
+
+func readOnlyRootFilesystem(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.Security != nil && n8n.Spec.Security.ReadOnlyRootFilesystem
+}
+
+// writableVolumes returns emptyDir volumes mounted at the given paths, so containers can write
+// there when their root filesystem is read-only
+func writableVolumes(n8n *n8nv1alpha1.N8n, paths map[string]string) ([]corev1.Volume, []corev1.VolumeMount) {
+	if !readOnlyRootFilesystem(n8n) {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for _, name := range names {
+		volumes = append(volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: paths[name],
+		})
+	}
+	return volumes, mounts
+}
+
+// syncVolume adds, updates or removes the named volume of the pod and its mount in the container to match
+// the desired volumes and mounts, and reports whether anything changed
+func syncVolume(pod *corev1.PodSpec, container *corev1.Container, name string, volumes []corev1.Volume, mounts []corev1.VolumeMount) bool {
+	changed := false
+	desiredVolume := slices.IndexFunc(volumes, func(v corev1.Volume) bool { return v.Name == name })
+	currentVolume := slices.IndexFunc(pod.Volumes, func(v corev1.Volume) bool { return v.Name == name })
+	switch {
+	case desiredVolume >= 0 && currentVolume < 0:
+		pod.Volumes = append(pod.Volumes, volumes[desiredVolume])
+		changed = true
+	// The API server defaults fields of volume sources, only compare the ones set here
+	case desiredVolume >= 0 && !equality.Semantic.DeepDerivative(volumes[desiredVolume], pod.Volumes[currentVolume]):
+		pod.Volumes[currentVolume] = volumes[desiredVolume]
+		changed = true
+	case desiredVolume < 0 && currentVolume >= 0:
+		pod.Volumes = slices.Delete(pod.Volumes, currentVolume, currentVolume+1)
+		changed = true
+	}
+
+	desiredMount := slices.IndexFunc(mounts, func(m corev1.VolumeMount) bool { return m.Name == name })
+	currentMount := slices.IndexFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == name })
+	switch {
+	case desiredMount >= 0 && currentMount < 0:
+		container.VolumeMounts = append(container.VolumeMounts, mounts[desiredMount])
+		changed = true
+	case desiredMount >= 0 && !equality.Semantic.DeepDerivative(mounts[desiredMount], container.VolumeMounts[currentMount]):
+		container.VolumeMounts[currentMount] = mounts[desiredMount]
+		changed = true
+	case desiredMount < 0 && currentMount >= 0:
+		container.VolumeMounts = slices.Delete(container.VolumeMounts, currentMount, currentMount+1)
+		changed = true
 	}
+	return changed
 }
 
-func getContainerSecurityContext() *corev1.SecurityContext {
-	return &corev1.SecurityContext{
-		RunAsNonRoot:             &[]bool{true}[0],
-		RunAsUser:                &[]int64{defaultUserID}[0],
-		AllowPrivilegeEscalation: &[]bool{false}[0],
-		Capabilities: &corev1.Capabilities{
-			Drop: []corev1.Capability{
-				"ALL",
+// secretEnvVar returns an environment variable sourced from a key of a Secret
+func secretEnvVar(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  key,
 			},
 		},
 	}
 }
 
-func getN8nEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
-	return []corev1.EnvVar{
+func getN8nEnvVars(n8n *n8nv1alpha1.N8n, urls n8nURLs, encryptionKeyFromSecret bool) []corev1.EnvVar {
+	envVars := []corev1.EnvVar{
 		{
 			Name:  "DB_TYPE",
 			Value: "postgresdb",
@@ -69,25 +175,50 @@ func getN8nEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
 			Name:  "N8N_USER_FOLDER",
 			Value: "/home/node",
 		},
-		{
-			Name:  "N8N_EDITOR_BASE_URL",
-			Value: fmt.Sprintf("https://%s", n8n.Spec.Hostname.Url),
-		},
 		{
 			Name:  "N8N_TEMPLATES_ENABLED",
 			Value: "true",
 		},
 		{
-			Name:  "N8N_HOST",
-			Value: fmt.Sprintf("https://%s", n8n.Spec.Hostname.Url),
+			Name:  "N8N_PORT",
+			Value: fmt.Sprintf("%d", n8nContainerPort),
+		},
+		{
+			Name:  "N8N_PROTOCOL",
+			Value: urls.protocol,
 		},
 		{
-			Name:  "WEBHOOK_URL",
-			Value: n8n.Spec.Hostname.Url,
+			Name:  "N8N_PATH",
+			Value: urls.path,
 		},
 		{
 			Name:  "N8N_METRICS",
-			Value: fmt.Sprintf("%t", n8n.Spec.Metrics != nil && n8n.Spec.Metrics.Enable),
+			Value: fmt.Sprintf("%t", metricsEnabled(n8n)),
 		},
 	}
+	// Without a hostname n8n falls back to localhost
+	if urls.editorHost != "" {
+		envVars = append(envVars,
+			corev1.EnvVar{Name: "N8N_HOST", Value: urls.editorHost},
+			corev1.EnvVar{Name: "N8N_EDITOR_BASE_URL", Value: urls.url(urls.editorHost)},
+			corev1.EnvVar{Name: "WEBHOOK_URL", Value: urls.url(urls.webhookHost)},
+		)
+	}
+	if servingTLS(n8n) {
+		envVars = append(envVars,
+			corev1.EnvVar{Name: "N8N_SSL_KEY", Value: servingCertPath + "/tls.key"},
+			corev1.EnvVar{Name: "N8N_SSL_CERT", Value: servingCertPath + "/tls.crt"},
+		)
+	}
+	envVars = append(envVars, getMetricsEnvVars(n8n)...)
+	envVars = append(envVars, getSMTPEnvVars(n8n)...)
+	envVars = append(envVars, getBinaryDataEnvVars(n8n)...)
+	envVars = append(envVars, getExternalSecretsEnvVars(n8n)...)
+	if encryptionKeyFromSecret {
+		envVars = append(envVars, getEncryptionKeyEnvVars(n8n)...)
+	}
+	envVars = append(envVars, getQueueEnvVars(n8n)...)
+	envVars = append(envVars, getLicenseEnvVars(n8n)...)
+	envVars = append(envVars, getAuthEnvVars(n8n)...)
+	return envVars
 }
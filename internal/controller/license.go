@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	typeLicenseActivatedN8n = "LicenseActivated"
+	licenseRefreshInterval  = 10 * time.Minute
+	licenseRetryInterval    = 30 * time.Second
+)
+
+func licenseEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.License != nil && n8n.Spec.License.Enable
+}
+
+// getLicenseEnvVars returns the environment variables activating the n8n license
+func getLicenseEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
+	if !licenseEnabled(n8n) {
+		return nil
+	}
+
+	license := n8n.Spec.License
+	envVars := []corev1.EnvVar{
+		{
+			Name:  "N8N_LICENSE_AUTO_RENEW_ENABLED",
+			Value: fmt.Sprintf("%t", license.AutoRenew == nil || *license.AutoRenew),
+		},
+	}
+
+	if license.ActivationKeySecret != nil {
+		envVars = append(envVars, secretEnvVar("N8N_LICENSE_ACTIVATION_KEY", license.ActivationKeySecret.Name, license.ActivationKeySecret.Key))
+	}
+
+	if license.ServerURL != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "N8N_LICENSE_SERVER_URL",
+			Value: license.ServerURL,
+		})
+	}
+
+	return envVars
+}
+
+// reconcileLicenseStatus reads the license state from the running n8n instance
+func (r *N8nReconciler) reconcileLicenseStatus(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	if !licenseEnabled(n8n) {
+		changed := meta.RemoveStatusCondition(&n8n.Status.Conditions, typeLicenseActivatedN8n)
+		if n8n.Status.License != nil {
+			n8n.Status.License = nil
+			changed = true
+		}
+		if changed {
+			return r.Status().Update(ctx, n8n)
+		}
+		return nil
+	}
+
+	// Avoid polling n8n on every reconciliation, the license changes rarely
+	if n8n.Status.License != nil && n8n.Status.License.LastCheckedTime != nil &&
+		time.Since(n8n.Status.License.LastCheckedTime.Time) < licenseRefreshInterval {
+		return nil
+	}
+
+	previous := meta.FindStatusCondition(n8n.Status.Conditions, typeLicenseActivatedN8n)
+	previousPlan := ""
+	if n8n.Status.License != nil {
+		previousPlan = n8n.Status.License.Plan
+	}
+	available, err := r.n8nAvailable(ctx, n8n)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return r.updateStatus(ctx, n8n, typeLicenseActivatedN8n, metav1.ConditionUnknown, "WaitingForN8n",
+			"Waiting for n8n to become available before reading the license state")
+	}
+
+	license, err := r.readLicenseStatus(ctx, n8n, n8nServiceURL(n8n))
+	if err != nil {
+		if err := r.updateStatus(ctx, n8n, typeLicenseActivatedN8n, metav1.ConditionUnknown, "Unreachable",
+			fmt.Sprintf("Unable to read the license state from n8n: %v", err)); err != nil {
+			return err
+		}
+		// Returning the error retries with backoff
+		return fmt.Errorf("failed to read the license state from n8n: %w", err)
+	}
+	n8n.Status.License = license
+
+	// n8n doesn't expose the expiry date, a lapsed license shows as the plan falling back to community
+	switch {
+	case !planActive(license.Plan) && planActive(previousPlan):
+		message := fmt.Sprintf("License plan %s is no longer active, n8n fell back to the community edition", previousPlan)
+		r.Recorder.Event(n8n, "Warning", "LicenseLapsed", message)
+		return r.updateStatus(ctx, n8n, typeLicenseActivatedN8n, metav1.ConditionFalse, "Lapsed", message)
+	case !planActive(license.Plan) && previous != nil && previous.Reason == "Lapsed":
+		return r.updateStatus(ctx, n8n, typeLicenseActivatedN8n, metav1.ConditionFalse, "Lapsed", previous.Message)
+	case !planActive(license.Plan):
+		return r.updateStatus(ctx, n8n, typeLicenseActivatedN8n, metav1.ConditionFalse, "NotActivated",
+			"n8n reports no activated enterprise license")
+	case len(license.MissingFeatures) > 0:
+		return r.updateStatus(ctx, n8n, typeLicenseActivatedN8n, metav1.ConditionFalse, "FeaturesNotLicensed",
+			fmt.Sprintf("License plan %s doesn't grant the configured features: %s", license.Plan,
+				strings.Join(license.MissingFeatures, ", ")))
+	}
+	return r.updateStatus(ctx, n8n, typeLicenseActivatedN8n, metav1.ConditionTrue, "Activated",
+		fmt.Sprintf("License plan %s is active", license.Plan))
+}
+
+// planActive reports whether the license plan is an enterprise plan
+func planActive(plan string) bool {
+	return plan != "" && !strings.EqualFold(plan, "Community")
+}
+
+// requiredLicenseFeatures returns the enterprise features, as named in the n8n settings, the
+// configuration relies on
+func requiredLicenseFeatures(n8n *n8nv1alpha1.N8n) []string {
+	var features []string
+	if auth := n8n.Spec.Auth; auth != nil {
+		if auth.SAML != nil && auth.SAML.Enable {
+			features = append(features, "saml")
+		}
+		if auth.OIDC != nil && auth.OIDC.Enable {
+			features = append(features, "oidc")
+		}
+		if auth.LDAP != nil && auth.LDAP.Enable {
+			features = append(features, "ldap")
+		}
+	}
+	if externalSecretsEnabled(n8n) {
+		features = append(features, "externalSecrets")
+	}
+	if binaryDataMode(n8n) == n8nv1alpha1.BinaryDataModeS3 {
+		features = append(features, "binaryDataS3")
+	}
+	return features
+}
+
+// readLicenseStatus reads the license plan and features from the n8n instance at baseURL, and the
+// workflow trigger quota when the operator can log in as the owner
+func (r *N8nReconciler) readLicenseStatus(ctx context.Context, n8n *n8nv1alpha1.N8n, baseURL string) (*n8nv1alpha1.LicenseStatus, error) {
+	settings, err := newN8nAPIClient(baseURL).settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var features []string
+	for feature, enabled := range settings.Data.Enterprise {
+		if on, ok := enabled.(bool); ok && on {
+			features = append(features, feature)
+		}
+	}
+	sort.Strings(features)
+
+	var missing []string
+	for _, feature := range requiredLicenseFeatures(n8n) {
+		if !slices.Contains(features, feature) {
+			missing = append(missing, feature)
+		}
+	}
+
+	now := metav1.Now()
+	license := &n8nv1alpha1.LicenseStatus{
+		Plan:            settings.Data.License.PlanName,
+		Features:        features,
+		MissingFeatures: missing,
+		LastCheckedTime: &now,
+	}
+
+	// The quota is only readable by the owner
+	if n8n.Spec.Auth == nil || n8n.Spec.Auth.AdminCredentialsSecret == nil {
+		return license, nil
+	}
+	apiClient, err := r.ownerClient(ctx, n8n, baseURL)
+	if err == nil {
+		err = apiClient.licenseUsage(ctx, license)
+	}
+	if err != nil {
+		log.FromContext(ctx).Info("Unable to read license usage from n8n", "error", err.Error())
+	}
+	return license, nil
+}
+
+// licenseUsage reads the active workflow trigger quota into the license status
+func (c *n8nAPIClient) licenseUsage(ctx context.Context, license *n8nv1alpha1.LicenseStatus) error {
+	result := &struct {
+		Data struct {
+			Usage struct {
+				ActiveWorkflowTriggers struct {
+					Value int64 `json:"value"`
+					Limit int64 `json:"limit"`
+				} `json:"activeWorkflowTriggers"`
+			} `json:"usage"`
+		} `json:"data"`
+	}{}
+	if _, err := c.do(ctx, http.MethodGet, "/rest/license", nil, result); err != nil {
+		return err
+	}
+	triggers := result.Data.Usage.ActiveWorkflowTriggers
+	license.ActiveWorkflowTriggers = &triggers.Value
+	license.ActiveWorkflowTriggersLimit = &triggers.Limit
+	return nil
+}
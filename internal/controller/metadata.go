@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"encoding/json"
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// managedMetadataAnnotation records the label and annotation keys the operator set on an object, so keys
+// removed from the spec can be removed from the object without touching the ones added by others
+const managedMetadataAnnotation = "n8n.slys.dev/managed-metadata"
+
+// managedMetadata is the content of the managed metadata annotation
+type managedMetadata struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// recordManagedMetadata records the label and annotation keys of the desired object in its annotations
+func recordManagedMetadata(obj client.Object) {
+	annotations := obj.GetAnnotations()
+	record := managedMetadata{Labels: sortedKeys(obj.GetLabels())}
+	for _, key := range sortedKeys(annotations) {
+		if key != managedMetadataAnnotation {
+			record.Annotations = append(record.Annotations, key)
+		}
+	}
+	data, _ := json.Marshal(record)
+	// The annotations may be shared with the spec, don't modify them in place
+	recorded := map[string]string{}
+	mergeStringMap(&recorded, annotations)
+	recorded[managedMetadataAnnotation] = string(data)
+	obj.SetAnnotations(recorded)
+}
+
+// syncMetadata copies the labels and annotations of the desired object, prepared with recordManagedMetadata,
+// to the current one and removes the keys the operator set before that are no longer desired. It reports
+// whether the current object changed.
+func syncMetadata(current, desired client.Object) bool {
+	var previous managedMetadata
+	// Objects created before the keys were recorded have nothing to prune
+	_ = json.Unmarshal([]byte(current.GetAnnotations()[managedMetadataAnnotation]), &previous)
+
+	labels, annotations := current.GetLabels(), current.GetAnnotations()
+	changed := pruneStringMap(labels, previous.Labels, desired.GetLabels())
+	changed = pruneStringMap(annotations, previous.Annotations, desired.GetAnnotations()) || changed
+	changed = mergeStringMap(&labels, desired.GetLabels()) || changed
+	changed = mergeStringMap(&annotations, desired.GetAnnotations()) || changed
+	current.SetLabels(labels)
+	current.SetAnnotations(annotations)
+	return changed
+}
+
+// pruneStringMap deletes the previously set keys that are no longer desired from target and reports
+// whether it changed
+func pruneStringMap(target map[string]string, previous []string, desired map[string]string) bool {
+	changed := false
+	for _, key := range previous {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		if _, ok := target[key]; ok {
+			delete(target, key)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
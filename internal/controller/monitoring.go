@@ -1,36 +1,209 @@
 package controller
 
 import (
+	"context"
+	"reflect"
+
 	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func (r *N8nReconciler) serviceMonitorForN8n(n8n *n8nv1alpha1.N8n) *monitoringv1.ServiceMonitor {
+var serviceMonitorGVK = monitoringv1.SchemeGroupVersion.WithKind(monitoringv1.ServiceMonitorsKind)
+
+func metricsEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.Metrics != nil && n8n.Spec.Metrics.Enable
+}
+
+// podMonitorEnabled reports whether the pods are scraped by a PodMonitor instead of a ServiceMonitor
+func podMonitorEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return metricsEnabled(n8n) && n8n.Spec.Metrics.PodMonitor != nil
+}
+
+// monitorConfigForN8n returns the scrape settings of the enabled monitor
+func monitorConfigForN8n(n8n *n8nv1alpha1.N8n) n8nv1alpha1.MonitorConfig {
+	if config := n8n.Spec.Metrics.PodMonitor; config != nil {
+		return *config
+	}
+	if config := n8n.Spec.Metrics.ServiceMonitor; config != nil {
+		return *config
+	}
+	return n8nv1alpha1.MonitorConfig{}
+}
+
+// monitorLabelsForN8n returns the labels of the monitor, the configured ones taking precedence
+func monitorLabelsForN8n(config n8nv1alpha1.MonitorConfig) map[string]string {
 	labels := labelsForN8n()
+	mergeStringMap(&labels, config.Labels)
+	return labels
+}
+
+// scrapeSchemeForN8n returns the scheme Prometheus scrapes n8n with, HTTPS when n8n serves TLS itself
+// or TLS settings are given
+func scrapeSchemeForN8n(n8n *n8nv1alpha1.N8n, config n8nv1alpha1.MonitorConfig) string {
+	if servingTLS(n8n) || config.TLSConfig != nil {
+		return "https"
+	}
+	return ""
+}
+
+func (r *N8nReconciler) serviceMonitorForN8n(n8n *n8nv1alpha1.N8n) (*monitoringv1.ServiceMonitor, error) {
+	config := monitorConfigForN8n(n8n)
+	endpoint := monitoringv1.Endpoint{
+		Port:                 "http",
+		Path:                 "/metrics",
+		Scheme:               scrapeSchemeForN8n(n8n, config),
+		Interval:             config.Interval,
+		ScrapeTimeout:        config.ScrapeTimeout,
+		RelabelConfigs:       config.Relabelings,
+		MetricRelabelConfigs: config.MetricRelabelings,
+	}
+	if config.TLSConfig != nil {
+		endpoint.TLSConfig = &monitoringv1.TLSConfig{SafeTLSConfig: *config.TLSConfig}
+	}
 
 	sm := &monitoringv1.ServiceMonitor{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      n8n.Name,
 			Namespace: n8n.Namespace,
-			Labels:    labels,
+			Labels:    monitorLabelsForN8n(config),
 		},
 		Spec: monitoringv1.ServiceMonitorSpec{
-			Endpoints: []monitoringv1.Endpoint{
-				{
-					Port: "http",
-					Path: "/metrics",
-				},
-			},
+			Endpoints: []monitoringv1.Endpoint{endpoint},
 			Selector: metav1.LabelSelector{
-				MatchLabels: labels,
+				MatchLabels: instanceLabelsForN8n(n8n),
 			},
 		},
 	}
 
 	if err := ctrl.SetControllerReference(n8n, sm, r.Scheme); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func (r *N8nReconciler) podMonitorForN8n(n8n *n8nv1alpha1.N8n) (*monitoringv1.PodMonitor, error) {
+	config := monitorConfigForN8n(n8n)
+	port := "http"
+	endpoint := monitoringv1.PodMetricsEndpoint{
+		Port:                 &port,
+		Path:                 "/metrics",
+		Scheme:               scrapeSchemeForN8n(n8n, config),
+		Interval:             config.Interval,
+		ScrapeTimeout:        config.ScrapeTimeout,
+		RelabelConfigs:       config.Relabelings,
+		MetricRelabelConfigs: config.MetricRelabelings,
+	}
+	endpoint.TLSConfig = config.TLSConfig
+
+	pm := &monitoringv1.PodMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n8n.Name,
+			Namespace: n8n.Namespace,
+			Labels:    monitorLabelsForN8n(config),
+		},
+		Spec: monitoringv1.PodMonitorSpec{
+			PodMetricsEndpoints: []monitoringv1.PodMetricsEndpoint{endpoint},
+			Selector: metav1.LabelSelector{
+				MatchLabels: instanceLabelsForN8n(n8n),
+			},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(n8n, pm, r.Scheme); err != nil {
+		return nil, err
+	}
+	return pm, nil
+}
+
+// createOrUpdateMonitor creates the ServiceMonitor or PodMonitor scraping n8n and removes the one not configured
+func (r *N8nReconciler) createOrUpdateMonitor(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	// ServiceMonitors and PodMonitors are installed together with the Prometheus Operator
+	available, err := r.apiAvailable(serviceMonitorGVK)
+	if err != nil {
+		return err
+	}
+	if !available {
+		if metricsEnabled(n8n) {
+			r.Recorder.Event(n8n, "Warning", "PrometheusOperatorNotInstalled",
+				"Scraping the metrics requires the Prometheus Operator")
+		}
 		return nil
 	}
-	return sm
+
+	if !metricsEnabled(n8n) || podMonitorEnabled(n8n) {
+		if err := r.deleteIfExists(ctx, n8n, &monitoringv1.ServiceMonitor{}); err != nil {
+			return err
+		}
+	}
+	if !podMonitorEnabled(n8n) {
+		if err := r.deleteIfExists(ctx, n8n, &monitoringv1.PodMonitor{}); err != nil {
+			return err
+		}
+	}
+	if !metricsEnabled(n8n) {
+		return nil
+	}
+
+	if podMonitorEnabled(n8n) {
+		pm, err := r.podMonitorForN8n(n8n)
+		if err != nil {
+			return err
+		}
+		recordManagedMetadata(pm)
+		return r.createOrUpdateSpec(ctx, pm, &monitoringv1.PodMonitor{}, func(existing client.Object) bool {
+			current := existing.(*monitoringv1.PodMonitor)
+			changed := syncMetadata(current, pm)
+			if !reflect.DeepEqual(current.Spec, pm.Spec) {
+				current.Spec = pm.Spec
+				changed = true
+			}
+			return changed
+		})
+	}
+
+	sm, err := r.serviceMonitorForN8n(n8n)
+	if err != nil {
+		return err
+	}
+	recordManagedMetadata(sm)
+	return r.createOrUpdateSpec(ctx, sm, &monitoringv1.ServiceMonitor{}, func(existing client.Object) bool {
+		current := existing.(*monitoringv1.ServiceMonitor)
+		changed := syncMetadata(current, sm)
+		if !reflect.DeepEqual(current.Spec, sm.Spec) {
+			current.Spec = sm.Spec
+			changed = true
+		}
+		return changed
+	})
+}
+
+// getMetricsEnvVars returns the environment variables enabling the optional n8n metrics
+func getMetricsEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
+	if !metricsEnabled(n8n) || n8n.Spec.Metrics.Include == nil {
+		return nil
+	}
+	include := n8n.Spec.Metrics.Include
+	toggles := []struct {
+		name    string
+		enabled bool
+	}{
+		{"N8N_METRICS_INCLUDE_WORKFLOW_ID_LABEL", include.WorkflowIDLabel},
+		{"N8N_METRICS_INCLUDE_NODE_TYPE_LABEL", include.NodeTypeLabel},
+		{"N8N_METRICS_INCLUDE_CREDENTIAL_TYPE_LABEL", include.CredentialTypeLabel},
+		{"N8N_METRICS_INCLUDE_API_ENDPOINTS", include.APIEndpoints},
+		{"N8N_METRICS_INCLUDE_CACHE_METRICS", include.CacheMetrics},
+		{"N8N_METRICS_INCLUDE_MESSAGE_EVENT_BUS_METRICS", include.MessageEventBusMetrics},
+		{"N8N_METRICS_INCLUDE_QUEUE_METRICS", include.QueueMetrics},
+	}
+	var envVars []corev1.EnvVar
+	for _, toggle := range toggles {
+		if toggle.enabled {
+			envVars = append(envVars, corev1.EnvVar{Name: toggle.name, Value: "true"})
+		}
+	}
+	return envVars
 }
@@ -2,17 +2,24 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const (
@@ -30,13 +37,27 @@ type N8nReconciler struct {
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=n8n.slys.dev,resources=n8ns,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=n8n.slys.dev,resources=n8ns/status,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+// +kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=create;update
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=podmonitors,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=keda.sh,resources=scaledobjects;triggerauthentications,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 
 func (r *N8nReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
@@ -85,7 +106,14 @@ func (r *N8nReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 				return ctrl.Result{}, err
 			}
 
-			r.doFinalizerOperationsForN8n(n8n)
+			done, err := r.doFinalizerOperationsForN8n(ctx, n8n)
+			if err != nil {
+				log.Error(err, "Failed to perform finalizer operations for n8n")
+				return ctrl.Result{}, err
+			}
+			if !done {
+				return ctrl.Result{RequeueAfter: finalizerPollInterval}, nil
+			}
 
 			if err = r.updateStatus(ctx, n8n, typeDegradedN8n, metav1.ConditionTrue, "Finalizing",
 				fmt.Sprintf("Finalizer operations for custom resource %s were successfully accomplished", n8n.Name)); err != nil {
@@ -104,8 +132,70 @@ func (r *N8nReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, nil
 	}
 
+	// Leave the child resources alone while reconciliation is paused
+	if isPaused, err := r.reconcilePause(ctx, n8n); err != nil || isPaused {
+		return ctrl.Result{}, err
+	}
+
+	// Validate the configuration before touching any child resources
+	shared, err := r.sharedStorage(ctx, n8n)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := validateN8n(n8n, shared); err != nil {
+		log.Error(err, "Invalid n8n configuration")
+		r.Recorder.Event(n8n, "Warning", reasonInvalidConfiguration, err.Error())
+		if err := r.updateStatus(ctx, n8n, typeAvailableN8n, metav1.ConditionFalse, reasonInvalidConfiguration, err.Error()); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Reconcile encryption key Secret
+	encryptionKeyFromSecret, err := r.reconcileEncryptionKey(ctx, n8n)
+	var missingKey *encryptionKeyMissingError
+	if errors.As(err, &missingKey) {
+		log.Error(err, "Encryption key missing")
+		r.Recorder.Event(n8n, "Warning", reasonEncryptionKeyMissing, err.Error())
+		return ctrl.Result{}, r.updateStatus(ctx, n8n, typeAvailableN8n, metav1.ConditionFalse, reasonEncryptionKeyMissing, err.Error())
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile PersistentVolumeClaim
+	if err := r.createOrUpdatePVC(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Reconcile Deployment
-	if err := r.createOrUpdateDeployment(ctx, n8n); err != nil {
+	if err := r.createOrUpdateDeployment(ctx, n8n, encryptionKeyFromSecret); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile n8n version
+	if err := r.reconcileUpgrade(ctx, n8n); err != nil {
+		log.Error(err, "Failed to reconcile n8n version")
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile replicas and maintenance page
+	if err := r.reconcileSuspension(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile queue mode workers
+	if err := r.createOrUpdateWorkers(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile autoscaler
+	if err := r.createOrUpdateAutoscaler(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile PodDisruptionBudget
+	if err := r.createOrUpdatePodDisruptionBudget(ctx, n8n); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -114,6 +204,11 @@ func (r *N8nReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, err
 	}
 
+	// Reconcile NetworkPolicy
+	if err := r.createOrUpdateNetworkPolicy(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Reconcile Ingress
 	if err := r.createOrUpdateIngress(ctx, n8n); err != nil {
 		return ctrl.Result{}, err
@@ -124,8 +219,50 @@ func (r *N8nReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, err
 	}
 
-	// Reconcile ServiceMonitor
-	if err := r.createOrUpdateServiceMonitor(ctx, n8n); err != nil {
+	// Reconcile HTTPRoute status reported by the gateways
+	if err := r.reconcileHTTPRouteStatus(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile OpenShift Route
+	if err := r.reconcileRoute(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile cert-manager Certificates
+	if err := r.reconcileCertificates(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile ServiceMonitor or PodMonitor
+	if err := r.createOrUpdateMonitor(ctx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Nothing answers the n8n API while suspended
+	if suspended(n8n) {
+		if err := r.updateStatus(ctx, n8n, typeAvailableN8n, metav1.ConditionFalse, "Suspended",
+			fmt.Sprintf("Custom resource (%s) is suspended", n8n.Name)); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// The n8n API calls below share a time budget, failures are retried with backoff
+	apiCtx := withN8nAPIBudget(ctx, n8nAPIBudget)
+
+	// Reconcile license status
+	if err := r.reconcileLicenseStatus(apiCtx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile identity provider settings
+	if err := r.reconcileAuth(apiCtx, n8n); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile external secrets provider
+	if err := r.reconcileExternalSecrets(apiCtx, n8n); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -135,18 +272,104 @@ func (r *N8nReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueIntervalForN8n(n8n)}, nil
 }
 
-func (r *N8nReconciler) doFinalizerOperationsForN8n(cr *n8nv1alpha1.N8n) {
-	r.Recorder.Event(cr, "Warning", "Deleting",
-		fmt.Sprintf("Custom Resource %s is being deleted from the namespace %s",
-			cr.Name,
-			cr.Namespace))
+// requeueIntervalForN8n returns how soon the n8n instance must be reconciled again to observe
+// state the operator isn't notified about, or zero when it only reacts to changes
+func requeueIntervalForN8n(n8n *n8nv1alpha1.N8n) time.Duration {
+	var interval time.Duration
+	shorten := func(d time.Duration) {
+		if interval == 0 || d < interval {
+			interval = d
+		}
+	}
+
+	if licenseEnabled(n8n) {
+		shorten(licenseRefreshInterval)
+	}
+	if licenseEnabled(n8n) && n8n.Status.License == nil {
+		shorten(licenseRetryInterval)
+	}
+	if (authProvidersConfigured(n8n) || len(n8n.Status.AuthProviders) > 0) && !meta.IsStatusConditionTrue(n8n.Status.Conditions, typeAuthConfiguredN8n) {
+		shorten(authRetryInterval)
+	}
+	if externalSecretsEnabled(n8n) && !meta.IsStatusConditionTrue(n8n.Status.Conditions, typeExternalSecretsReadyN8n) {
+		shorten(externalSecretsRetryInterval)
+	}
+	if meta.IsStatusConditionTrue(n8n.Status.Conditions, typeUpgradeInProgressN8n) {
+		shorten(upgradePollInterval)
+	}
+	if meta.IsStatusConditionTrue(n8n.Status.Conditions, typeStorageResizingN8n) {
+		shorten(storageResizePollInterval)
+	}
+	if certManagerEnabled(n8n) && !meta.IsStatusConditionTrue(n8n.Status.Conditions, typeCertificateReadyN8n) {
+		shorten(certificatePollInterval)
+	}
+	if httpRouteEnabled(n8n) && !(meta.IsStatusConditionTrue(n8n.Status.Conditions, typeHTTPRouteAcceptedN8n) &&
+		meta.IsStatusConditionTrue(n8n.Status.Conditions, typeHTTPRouteProgrammedN8n)) {
+		shorten(httpRoutePollInterval)
+	}
+	if routeEnabled(n8n) && !meta.IsStatusConditionTrue(n8n.Status.Conditions, typeRouteAdmittedN8n) {
+		shorten(routePollInterval)
+	}
+	return interval
 }
 
 func (r *N8nReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&n8nv1alpha1.N8n{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.n8nsReferencing(watchedSecretNames))).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.n8nsReferencing(watchedConfigMapNames))).
 		Complete(r)
 }
+
+// watchedSecretNames returns the Secrets holding the encryption key and the settings the operator
+// applies through the n8n API
+func watchedSecretNames(n8n *n8nv1alpha1.N8n) []string {
+	names := []string{encryptionKeyRef(n8n).Name}
+	if externalSecretsEnabled(n8n) {
+		for _, ref := range externalSecretRefs(n8n) {
+			names = append(names, ref.Name)
+		}
+	}
+	if auth := n8n.Spec.Auth; auth != nil {
+		if auth.AdminCredentialsSecret != nil {
+			names = append(names, auth.AdminCredentialsSecret.Name)
+		}
+		if auth.OIDC != nil && auth.OIDC.ClientSecret != nil {
+			names = append(names, auth.OIDC.ClientSecret.Name)
+		}
+		if auth.LDAP != nil && auth.LDAP.BindPasswordSecret != nil {
+			names = append(names, auth.LDAP.BindPasswordSecret.Name)
+		}
+	}
+	return names
+}
+
+// watchedConfigMapNames returns the ConfigMaps holding settings the operator applies through the n8n API
+func watchedConfigMapNames(n8n *n8nv1alpha1.N8n) []string {
+	if auth := n8n.Spec.Auth; auth != nil && auth.SAML != nil && auth.SAML.MetadataConfigMap != nil {
+		return []string{auth.SAML.MetadataConfigMap.Name}
+	}
+	return nil
+}
+
+// n8nsReferencing maps an object to the N8n resources in its namespace naming it, so that edits to
+// settings n8n only learns about through its API are applied again and restored Secrets are noticed
+func (r *N8nReconciler) n8nsReferencing(names func(*n8nv1alpha1.N8n) []string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		list := &n8nv1alpha1.N8nList{}
+		if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace())); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list n8n resources")
+			return nil
+		}
+		var requests []reconcile.Request
+		for i := range list.Items {
+			if slices.Contains(names(&list.Items[i]), obj.GetName()) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+			}
+		}
+		return requests
+	}
+}
@@ -18,6 +18,12 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"time"
 
 	cachev1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
@@ -25,10 +31,21 @@ import (
 	. "github.com/onsi/gomega"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
@@ -172,6 +189,52 @@ var _ = Describe("N8n Controller", func() {
 					sm.Spec.Endpoints[0].Path == "/metrics"
 			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
 		})
+
+		It("should apply security changes to the Deployment", func() {
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Harden the security settings
+			Eventually(func() error {
+				updated := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
+					return err
+				}
+				updated.Spec.Security = &cachev1alpha1.SecurityConfig{
+					ReadOnlyRootFilesystem: true,
+					PodSecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: &[]bool{true}[0],
+						FSGroup:      &[]int64{2000}[0],
+					},
+				}
+				return k8sClient.Update(ctx, updated)
+			}, time.Second*5, time.Millisecond*100).Should(Succeed())
+
+			// Verify the pod template follows
+			Eventually(func() bool {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				dep := &appsv1.Deployment{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, dep); err != nil {
+					return false
+				}
+				pod := dep.Spec.Template.Spec
+				container := n8nContainer(dep)
+				hasTmp := slices.ContainsFunc(pod.Volumes, func(v corev1.Volume) bool { return v.Name == "tmp" }) &&
+					slices.ContainsFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.MountPath == "/tmp" })
+				return pod.SecurityContext != nil && pod.SecurityContext.FSGroup != nil && *pod.SecurityContext.FSGroup == 2000 &&
+					container.SecurityContext != nil && container.SecurityContext.ReadOnlyRootFilesystem != nil &&
+					*container.SecurityContext.ReadOnlyRootFilesystem && hasTmp
+			}, time.Second*10, time.Millisecond*100).Should(BeTrue())
+
+			// Cleanup
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+		})
 	})
 
 	Context("When reconciling a resource without metrics", func() {
@@ -281,6 +344,193 @@ var _ = Describe("N8n Controller", func() {
 		})
 	})
 
+	Context("When resizing persistent storage", func() {
+		It("should expand the PVC and refuse to shrink it", func() {
+			claimName := types.NamespacedName{Name: resourceName + "-data", Namespace: "default"}
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+			_ = k8sClient.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-encryption-key", Namespace: "default"}})
+			removeClaim := func() {
+				pvc := &corev1.PersistentVolumeClaim{}
+				if err := k8sClient.Get(ctx, claimName, pvc); err == nil {
+					// Without the PVC protection controller the finalizer is never removed
+					pvc.Finalizers = nil
+					_ = k8sClient.Update(ctx, pvc)
+					_ = k8sClient.Delete(ctx, pvc)
+				}
+				Eventually(func() bool {
+					return errors.IsNotFound(k8sClient.Get(ctx, claimName, &corev1.PersistentVolumeClaim{}))
+				}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+			}
+			removeClaim()
+
+			allowExpansion := true
+			storageClass := &storagev1.StorageClass{
+				ObjectMeta:           metav1.ObjectMeta{Name: "expandable"},
+				Provisioner:          "example.com/provisioner",
+				AllowVolumeExpansion: &allowExpansion,
+			}
+			Expect(k8sClient.Create(ctx, storageClass)).To(Succeed())
+
+			By("creating the custom resource with a 1Gi volume")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+						},
+					},
+					PersistentStorage: &cachev1alpha1.PersistentStorageConfig{
+						Enable:           true,
+						StorageClassName: "expandable",
+						Size:             "1Gi",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Claims can only be expanded once bound
+			setCapacity := func(size string) {
+				pvc := &corev1.PersistentVolumeClaim{}
+				Expect(k8sClient.Get(ctx, claimName, pvc)).To(Succeed())
+				pvc.Status.Phase = corev1.ClaimBound
+				pvc.Status.AccessModes = pvc.Spec.AccessModes
+				pvc.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: apiresource.MustParse(size)}
+				Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+			}
+			setCapacity("1Gi")
+			setSize := func(size string) error {
+				updated := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
+					return err
+				}
+				updated.Spec.PersistentStorage.Size = size
+				return k8sClient.Update(ctx, updated)
+			}
+			storageResizing := func() *metav1.Condition {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				n8n := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, n8n); err != nil {
+					return nil
+				}
+				return meta.FindStatusCondition(n8n.Status.Conditions, typeStorageResizingN8n)
+			}
+
+			By("growing the volume")
+			Eventually(func() error { return setSize("2Gi") }, time.Second*5, time.Millisecond*100).Should(Succeed())
+			Eventually(func() string {
+				if cond := storageResizing(); cond != nil && cond.Status == metav1.ConditionTrue {
+					return cond.Reason
+				}
+				return ""
+			}, time.Second*10, time.Millisecond*100).Should(Equal("Resizing"))
+			pvc := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, claimName, pvc)).To(Succeed())
+			Expect(pvc.Spec.Resources.Requests[corev1.ResourceStorage]).To(Equal(apiresource.MustParse("2Gi")))
+
+			By("completing the expansion")
+			setCapacity("2Gi")
+			Eventually(func() string {
+				if cond := storageResizing(); cond != nil && cond.Status == metav1.ConditionFalse {
+					return cond.Reason
+				}
+				return ""
+			}, time.Second*10, time.Millisecond*100).Should(Equal("Resized"))
+
+			By("shrinking the volume")
+			err := setSize("500Mi")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("size can't be decreased"))
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+			Expect(k8sClient.Delete(ctx, storageClass)).To(Succeed())
+			removeClaim()
+		})
+	})
+
+	Context("When using existing storage", func() {
+		It("should read the access modes from the claim", func() {
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n-shared", Namespace: "default"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: apiresource.MustParse("1Gi")},
+					},
+				},
+			}
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, claim))).To(Succeed())
+
+			storage := func(config cachev1alpha1.PersistentStorageConfig) *cachev1alpha1.N8n {
+				config.Enable = true
+				return &cachev1alpha1.N8n{
+					ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+					Spec:       cachev1alpha1.N8nSpec{PersistentStorage: &config},
+				}
+			}
+			readWriteOnce := []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+			readWriteMany := []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+
+			Expect(reconciler.sharedStorage(ctx, storage(cachev1alpha1.PersistentStorageConfig{
+				ExistingClaim: "n8n-shared", AccessModes: readWriteOnce,
+			}))).To(BeTrue())
+			Expect(reconciler.sharedStorage(ctx, storage(cachev1alpha1.PersistentStorageConfig{
+				VolumeSource: &corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "n8n-shared"}},
+			}))).To(BeTrue())
+			Expect(reconciler.sharedStorage(ctx, storage(cachev1alpha1.PersistentStorageConfig{
+				VolumeSource: &corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/n8n"}},
+			}))).To(BeTrue())
+			// Claims that don't exist yet are created with the configured access modes
+			Expect(reconciler.sharedStorage(ctx, storage(cachev1alpha1.PersistentStorageConfig{
+				ExistingClaim: "n8n-missing", AccessModes: readWriteMany,
+			}))).To(BeTrue())
+			Expect(reconciler.sharedStorage(ctx, storage(cachev1alpha1.PersistentStorageConfig{
+				ExistingClaim: "n8n-missing",
+			}))).To(BeFalse())
+		})
+
+		It("should point the data volume at the configured storage", func() {
+			pod := &corev1.PodSpec{Volumes: []corev1.Volume{{
+				Name: "n8n-data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: resourceName + "-data"},
+				},
+			}}}
+			desired := []corev1.Volume{{
+				Name: "n8n-data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "n8n-legacy-data"},
+				},
+			}}
+			Expect(syncDataVolume(pod, desired)).To(BeTrue())
+			Expect(pod.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("n8n-legacy-data"))
+			Expect(syncDataVolume(pod, desired)).To(BeFalse())
+
+			desired[0].VolumeSource = corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/n8n"}}
+			Expect(syncDataVolume(pod, desired)).To(BeTrue())
+			Expect(pod.Volumes[0].PersistentVolumeClaim).To(BeNil())
+			Expect(pod.Volumes[0].NFS.Server).To(Equal("nfs.example.com"))
+		})
+	})
+
 	Context("When reconciling a resource with HTTPRoute", func() {
 		It("should create HTTPRoute", func() {
 			By("creating the custom resource with HTTPRoute")
@@ -335,11 +585,8 @@ var _ = Describe("N8n Controller", func() {
 			// Cleanup
 			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
 		})
-	})
 
-	Context("When updating a resource", func() {
-		BeforeEach(func() {
-			By("creating the custom resource")
+		It("should delete the HTTPRoute when switching to an Ingress", func() {
 			resource := &cachev1alpha1.N8n{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      resourceName,
@@ -357,58 +604,69 @@ var _ = Describe("N8n Controller", func() {
 							Database: "n8n",
 							User:     "n8n",
 							Password: "n8n",
-							Ssl:      false,
 						},
 					},
+					HTTPRoute: &cachev1alpha1.HTTPRouteConfig{
+						Enable:     true,
+						GatewayRef: cachev1alpha1.GatewayRef{Name: "test-gateway"},
+					},
 				},
 			}
 			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
-		})
-
-		It("should handle spec updates", func() {
-			// Wait for initial reconciliation
 			Eventually(func() error {
-				_, err := reconciler.Reconcile(ctx, reconcile.Request{
-					NamespacedName: typeNamespacedName,
-				})
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 				return err
 			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, &gatewayv1.HTTPRoute{})).To(Succeed())
 
-			// Update the resource with metrics enabled
+			By("switching to an Ingress")
 			Eventually(func() error {
 				updated := &cachev1alpha1.N8n{}
 				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
 					return err
 				}
-				updated.Spec.Metrics = &cachev1alpha1.MetricsConfig{
-					Enable: true,
-				}
+				updated.Spec.HTTPRoute = nil
+				updated.Spec.Ingress = &cachev1alpha1.IngressConfig{Enable: true}
 				return k8sClient.Update(ctx, updated)
 			}, time.Second*5, time.Millisecond*100).Should(Succeed())
-
-			// Wait for reconciliation after update
 			Eventually(func() error {
-				_, err := reconciler.Reconcile(ctx, reconcile.Request{
-					NamespacedName: typeNamespacedName,
-				})
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 				return err
 			}, time.Second*10, time.Millisecond*100).Should(Succeed())
 
-			// Verify ServiceMonitor is created
 			Eventually(func() bool {
-				sm := &monitoringv1.ServiceMonitor{}
-				if err := k8sClient.Get(ctx, typeNamespacedName, sm); err != nil {
-					return false
-				}
-				return len(sm.Spec.Endpoints) == 1 &&
-					sm.Spec.Endpoints[0].Path == "/metrics"
+				err := k8sClient.Get(ctx, typeNamespacedName, &gatewayv1.HTTPRoute{})
+				return errors.IsNotFound(err)
 			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, &networkingv1.Ingress{})).To(Succeed())
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
 		})
 	})
 
-	Context("When resource creation fails", func() {
-		It("should validate required fields", func() {
-			By("creating the custom resource with invalid configuration")
+	Context("When a Deployment predates the instance selector", func() {
+		It("should recreate it selecting only the pods of the instance", func() {
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &appsv1.Deployment{}))
+			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+
+			By("creating a Deployment with the shared selector")
+			legacy := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: selectorLabelsForN8n()},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: selectorLabelsForN8n()},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "n8n", Image: n8nDockerImage}},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, legacy)).To(Succeed())
+
 			resource := &cachev1alpha1.N8n{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      resourceName,
@@ -417,39 +675,49 @@ var _ = Describe("N8n Controller", func() {
 				Spec: cachev1alpha1.N8nSpec{
 					Database: cachev1alpha1.Database{
 						Postgres: cachev1alpha1.Postgres{
-							Host:     "", // Invalid empty host
-							Port:     0,  // Invalid port
-							Database: "", // Invalid empty database
-							User:     "", // Invalid empty user
-							Password: "", // Invalid empty password
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
 						},
 					},
 				},
 			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 
-			err := k8sClient.Create(ctx, resource)
-			Expect(err).To(HaveOccurred())
-			statusErr, ok := err.(*errors.StatusError)
-			Expect(ok).To(BeTrue())
-			Expect(statusErr.Status().Code).To(Equal(int32(422)))
-			Expect(statusErr.Status().Reason).To(Equal(metav1.StatusReasonInvalid))
-			Expect(len(statusErr.Status().Details.Causes)).To(BeNumerically(">", 0))
+			Eventually(func() map[string]string {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				dep := &appsv1.Deployment{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, dep); err != nil {
+					return nil
+				}
+				return dep.Spec.Selector.MatchLabels
+			}, time.Second*10, time.Millisecond*100).Should(HaveKeyWithValue(instanceLabel, resourceName))
+
+			svc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, svc)).To(Succeed())
+			Expect(svc.Spec.Selector).To(Equal(instanceLabelsForN8n(resource)))
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
 		})
 	})
 
-	Context("When deleting a resource", func() {
-		It("should handle deletion", func() {
-			By("creating the custom resource")
+	Context("When routing the editor and the webhooks separately", func() {
+		It("should create an Ingress per endpoint and remove the stale webhook Ingress", func() {
+			webhookName := types.NamespacedName{Name: resourceName + "-webhook", Namespace: "default"}
+
+			By("creating the custom resource with routing")
 			resource := &cachev1alpha1.N8n{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      resourceName,
 					Namespace: "default",
 				},
 				Spec: cachev1alpha1.N8nSpec{
-					Hostname: &cachev1alpha1.HostnameConfig{
-						Enable: true,
-						Url:    "test.example.com",
-					},
 					Database: cachev1alpha1.Database{
 						Postgres: cachev1alpha1.Postgres{
 							Host:     "localhost",
@@ -457,35 +725,1781 @@ var _ = Describe("N8n Controller", func() {
 							Database: "n8n",
 							User:     "n8n",
 							Password: "n8n",
-							Ssl:      false,
+						},
+					},
+					Ingress: &cachev1alpha1.IngressConfig{
+						Enable:           true,
+						IngressClassName: "nginx",
+					},
+					Routing: &cachev1alpha1.RoutingConfig{
+						Editor: cachev1alpha1.EndpointConfig{
+							Hostname:         "n8n.internal.example.com",
+							IngressClassName: "nginx-internal",
+						},
+						Webhook: cachev1alpha1.WebhookEndpointConfig{
+							EndpointConfig: cachev1alpha1.EndpointConfig{Hostname: "hooks.example.com"},
 						},
 					},
 				},
 			}
 			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 
-			// Wait for initial reconciliation
 			Eventually(func() error {
 				_, err := reconciler.Reconcile(ctx, reconcile.Request{
 					NamespacedName: typeNamespacedName,
 				})
-				return err
+				if err != nil {
+					return err
+				}
+				return k8sClient.Get(ctx, webhookName, &networkingv1.Ingress{})
 			}, time.Second*10, time.Millisecond*100).Should(Succeed())
 
-			// Delete the resource
+			// Verify the editor Ingress
+			editor := &networkingv1.Ingress{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, editor)).To(Succeed())
+			Expect(*editor.Spec.IngressClassName).To(Equal("nginx-internal"))
+			Expect(editor.Spec.Rules).To(HaveLen(1))
+			Expect(editor.Spec.Rules[0].Host).To(Equal("n8n.internal.example.com"))
+			Expect(editor.Spec.Rules[0].HTTP.Paths).To(HaveLen(1))
+			Expect(editor.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/"))
+
+			// Verify the webhook Ingress
+			webhook := &networkingv1.Ingress{}
+			Expect(k8sClient.Get(ctx, webhookName, webhook)).To(Succeed())
+			Expect(*webhook.Spec.IngressClassName).To(Equal("nginx"))
+			Expect(webhook.Spec.Rules).To(HaveLen(1))
+			Expect(webhook.Spec.Rules[0].Host).To(Equal("hooks.example.com"))
+			var paths []string
+			for _, path := range webhook.Spec.Rules[0].HTTP.Paths {
+				paths = append(paths, path.Path)
+			}
+			Expect(paths).To(Equal([]string{"/webhook", "/webhook-test", "/webhook-waiting"}))
+
+			By("serving everything on a single hostname")
 			Eventually(func() error {
-				n8n := &cachev1alpha1.N8n{}
-				if err := k8sClient.Get(ctx, typeNamespacedName, n8n); err != nil {
+				updated := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
 					return err
 				}
-				return k8sClient.Delete(ctx, n8n)
+				updated.Spec.Routing = nil
+				updated.Spec.Hostname = &cachev1alpha1.HostnameConfig{Enable: true, Url: "n8n.example.com"}
+				return k8sClient.Update(ctx, updated)
 			}, time.Second*5, time.Millisecond*100).Should(Succeed())
 
-			// Verify deletion handling
 			Eventually(func() bool {
-				err := k8sClient.Get(ctx, typeNamespacedName, &cachev1alpha1.N8n{})
-				return errors.IsNotFound(err)
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return errors.IsNotFound(k8sClient.Get(ctx, webhookName, &networkingv1.Ingress{}))
 			}, time.Second*10, time.Millisecond*100).Should(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, editor)).To(Succeed())
+			Expect(editor.Spec.Rules[0].Host).To(Equal("n8n.example.com"))
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+	})
+
+	Context("When configuring the Ingress", func() {
+		It("should route the additional hosts and the path with the path type", func() {
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{Enable: true, Url: "n8n.example.com", Path: "/editor/"},
+					Ingress: &cachev1alpha1.IngressConfig{
+						Enable:   true,
+						Hosts:    []string{"automation.example.com"},
+						Path:     "/editor",
+						PathType: "Exact",
+						TLS:      []cachev1alpha1.IngressTLS{{Hosts: []string{"automation.example.com"}, SecretName: "automation-tls"}},
+					},
+				},
+			}
+			Expect(validateExposure(n8n)).To(Succeed())
+			ing := reconciler.ingressForN8n(n8n, endpointsForN8n(n8n)[0])
+
+			var hosts []string
+			for _, rule := range ing.Spec.Rules {
+				hosts = append(hosts, rule.Host)
+				Expect(rule.HTTP.Paths).To(HaveLen(1))
+				Expect(rule.HTTP.Paths[0].Path).To(Equal("/editor"))
+				Expect(*rule.HTTP.Paths[0].PathType).To(Equal(networkingv1.PathTypeExact))
+			}
+			Expect(hosts).To(Equal([]string{"n8n.example.com", "automation.example.com"}))
+			Expect(ing.Spec.TLS).To(HaveLen(1))
+			Expect(ing.Spec.TLS[0].SecretName).To(Equal("automation-tls"))
+		})
+
+		It("should remove the labels and annotations dropped from the spec", func() {
+			desired := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+				Labels:      map[string]string{"team": "automation"},
+				Annotations: map[string]string{"example.com/timeout": "60"},
+			}}
+			recordManagedMetadata(desired)
+			current := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{"example.com/added-by-others": "true"},
+			}}
+			Expect(syncMetadata(current, desired)).To(BeTrue())
+			Expect(current.Labels).To(HaveKeyWithValue("team", "automation"))
+			Expect(current.Annotations).To(HaveKeyWithValue("example.com/timeout", "60"))
+			Expect(syncMetadata(current, desired)).To(BeFalse())
+
+			// Drop the annotation and the label from the spec
+			desired = &networkingv1.Ingress{}
+			recordManagedMetadata(desired)
+			Expect(syncMetadata(current, desired)).To(BeTrue())
+			Expect(current.Labels).NotTo(HaveKey("team"))
+			Expect(current.Annotations).NotTo(HaveKey("example.com/timeout"))
+			Expect(current.Annotations).To(HaveKeyWithValue("example.com/added-by-others", "true"))
+		})
+	})
+
+	Context("When issuing certificates with cert-manager", func() {
+		It("should annotate the Ingress for its TLS Secrets", func() {
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{Enable: true, Url: "n8n.example.com"},
+					Ingress: &cachev1alpha1.IngressConfig{
+						Enable: true,
+						TLS: []cachev1alpha1.IngressTLS{{
+							Hosts:       []string{"n8n.example.com"},
+							SecretName:  "n8n-tls",
+							CertManager: &cachev1alpha1.CertManagerConfig{ClusterIssuer: "letsencrypt"},
+						}},
+					},
+				},
+			}
+			ing := reconciler.ingressForN8n(n8n, endpointsForN8n(n8n)[0])
+			Expect(ing.Annotations).To(HaveKeyWithValue(clusterIssuerAnnotation, "letsencrypt"))
+			Expect(ing.Annotations).NotTo(HaveKey(issuerAnnotation))
+			Expect(certificateNamesForN8n(n8n)).To(Equal([]string{"n8n-tls"}))
+
+			n8n.Spec.Ingress.TLS[0].CertManager = &cachev1alpha1.CertManagerConfig{Issuer: "internal-ca"}
+			ing = reconciler.ingressForN8n(n8n, endpointsForN8n(n8n)[0])
+			Expect(ing.Annotations).To(HaveKeyWithValue(issuerAnnotation, "internal-ca"))
+		})
+
+		It("should request a Certificate for the HTTPRoute hostnames", func() {
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default", UID: "test-uid"},
+				Spec: cachev1alpha1.N8nSpec{
+					HTTPRoute: &cachev1alpha1.HTTPRouteConfig{
+						Enable:     true,
+						GatewayRef: cachev1alpha1.GatewayRef{Name: "gateway", Namespace: "gateway-system"},
+						TLS: &cachev1alpha1.HTTPRouteTLS{
+							SecretName:  "n8n-route-tls",
+							CertManager: cachev1alpha1.CertManagerConfig{ClusterIssuer: "letsencrypt"},
+						},
+					},
+					Routing: &cachev1alpha1.RoutingConfig{
+						Editor: cachev1alpha1.EndpointConfig{Hostname: "n8n.example.com"},
+						Webhook: cachev1alpha1.WebhookEndpointConfig{
+							EndpointConfig: cachev1alpha1.EndpointConfig{Hostname: "hooks.example.com"},
+						},
+					},
+				},
+			}
+			cert, err := reconciler.certificateForN8n(n8n)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.GetName()).To(Equal(resourceName + "-tls"))
+			Expect(certificateNamesForN8n(n8n)).To(Equal([]string{resourceName + "-tls"}))
+
+			secretName, _, _ := unstructured.NestedString(cert.Object, "spec", "secretName")
+			Expect(secretName).To(Equal("n8n-route-tls"))
+			dnsNames, _, _ := unstructured.NestedSlice(cert.Object, "spec", "dnsNames")
+			Expect(dnsNames).To(Equal([]interface{}{"n8n.example.com", "hooks.example.com"}))
+			issuerRef, _, _ := unstructured.NestedStringMap(cert.Object, "spec", "issuerRef")
+			Expect(issuerRef).To(Equal(map[string]string{"name": "letsencrypt", "kind": "ClusterIssuer"}))
+
+			Expect(certificateReady(cert)).To(BeFalse())
+			Expect(unstructured.SetNestedSlice(cert.Object, []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+			}, "status", "conditions")).To(Succeed())
+			Expect(certificateReady(cert)).To(BeTrue())
+		})
+	})
+
+	Context("When changing the Service type", func() {
+		It("should keep the allocated node port", func() {
+			By("creating the custom resource with a NodePort Service")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+						},
+					},
+					Service: &cachev1alpha1.ServiceConfig{Type: corev1.ServiceTypeNodePort},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			var nodePort int32
+			Eventually(func() int32 {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				svc := &corev1.Service{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, svc); err != nil || svc.Spec.Type != corev1.ServiceTypeNodePort {
+					return 0
+				}
+				nodePort = svc.Spec.Ports[0].NodePort
+				return nodePort
+			}, time.Second*10, time.Millisecond*100).ShouldNot(BeZero())
+
+			By("switching to a LoadBalancer Service")
+			Eventually(func() error {
+				updated := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
+					return err
+				}
+				updated.Spec.Service.Type = corev1.ServiceTypeLoadBalancer
+				return k8sClient.Update(ctx, updated)
+			}, time.Second*5, time.Millisecond*100).Should(Succeed())
+
+			Eventually(func() bool {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				svc := &corev1.Service{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, svc); err != nil {
+					return false
+				}
+				return svc.Spec.Type == corev1.ServiceTypeLoadBalancer && svc.Spec.Ports[0].NodePort == nodePort
+			}, time.Second*10, time.Millisecond*100).Should(BeTrue())
+
+			By("switching back to a ClusterIP Service")
+			Eventually(func() error {
+				updated := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
+					return err
+				}
+				updated.Spec.Service = nil
+				return k8sClient.Update(ctx, updated)
+			}, time.Second*5, time.Millisecond*100).Should(Succeed())
+
+			Eventually(func() bool {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				svc := &corev1.Service{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, svc); err != nil {
+					return false
+				}
+				return svc.Spec.Type == corev1.ServiceTypeClusterIP && svc.Spec.Ports[0].NodePort == 0
+			}, time.Second*10, time.Millisecond*100).Should(BeTrue())
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+	})
+
+	Context("When reconciling a resource with SMTP", func() {
+		It("should configure the n8n container for SMTP", func() {
+			By("creating the custom resource with SMTP enabled")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{
+						Enable: true,
+						Url:    "test.example.com",
+					},
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+							Ssl:      false,
+						},
+					},
+					SMTP: &cachev1alpha1.SMTPConfig{
+						Enable: true,
+						Host:   "smtp.example.com",
+						Port:   587,
+						Sender: "n8n@example.com",
+						CredentialsSecret: &cachev1alpha1.SMTPCredentialsSecret{
+							Name: "n8n-smtp",
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			// Wait for initial reconciliation
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Verify the SMTP environment variables are set
+			Eventually(func() bool {
+				deployment := &appsv1.Deployment{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, deployment); err != nil {
+					return false
+				}
+				env := map[string]corev1.EnvVar{}
+				for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+					env[e.Name] = e
+				}
+				return env["N8N_EMAIL_MODE"].Value == "smtp" &&
+					env["N8N_SMTP_HOST"].Value == "smtp.example.com" &&
+					env["N8N_SMTP_PORT"].Value == "587" &&
+					env["N8N_SMTP_PASS"].ValueFrom != nil &&
+					env["N8N_SMTP_PASS"].ValueFrom.SecretKeyRef.Name == "n8n-smtp" &&
+					env["N8N_SMTP_PASS"].ValueFrom.SecretKeyRef.Key == "password"
+			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should reject SMTP without a host", func() {
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+						},
+					},
+					SMTP: &cachev1alpha1.SMTPConfig{
+						Enable: true,
+						Sender: "n8n@example.com",
+					},
+				},
+			}
+
+			err := k8sClient.Create(ctx, resource)
+			Expect(err).To(HaveOccurred())
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+		})
+	})
+
+	Context("When reconciling a resource with S3 binary data", func() {
+		It("should configure the n8n container for S3", func() {
+			By("creating the custom resource with S3 binary data")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{
+						Enable: true,
+						Url:    "test.example.com",
+					},
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+							Ssl:      false,
+						},
+					},
+					BinaryData: &cachev1alpha1.BinaryDataConfig{
+						Mode: cachev1alpha1.BinaryDataModeS3,
+						S3: &cachev1alpha1.S3Config{
+							Endpoint: "s3.eu-central-1.amazonaws.com",
+							Bucket:   "n8n-data",
+							Region:   "eu-central-1",
+							CredentialsSecret: &cachev1alpha1.AWSCredentialsSecret{
+								Name: "n8n-s3",
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Verify the S3 settings and the access key references
+			Eventually(func() bool {
+				deployment := &appsv1.Deployment{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, deployment); err != nil {
+					return false
+				}
+				env := map[string]corev1.EnvVar{}
+				for _, e := range deployment.Spec.Template.Spec.Containers[0].Env {
+					env[e.Name] = e
+				}
+				accessKey, secretKey := env["N8N_EXTERNAL_STORAGE_S3_ACCESS_KEY"], env["N8N_EXTERNAL_STORAGE_S3_ACCESS_SECRET"]
+				return env["N8N_DEFAULT_BINARY_DATA_MODE"].Value == "s3" &&
+					env["N8N_AVAILABLE_BINARY_DATA_MODES"].Value == "filesystem,s3" &&
+					env["N8N_EXTERNAL_STORAGE_S3_HOST"].Value == "s3.eu-central-1.amazonaws.com" &&
+					env["N8N_EXTERNAL_STORAGE_S3_BUCKET_NAME"].Value == "n8n-data" &&
+					env["N8N_EXTERNAL_STORAGE_S3_BUCKET_REGION"].Value == "eu-central-1" &&
+					accessKey.ValueFrom != nil &&
+					accessKey.ValueFrom.SecretKeyRef.Name == "n8n-s3" &&
+					accessKey.ValueFrom.SecretKeyRef.Key == "accessKeyId" &&
+					secretKey.ValueFrom != nil &&
+					secretKey.ValueFrom.SecretKeyRef.Key == "secretAccessKey"
+			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should auto-detect credentials without a Secret", func() {
+			n8n := &cachev1alpha1.N8n{
+				Spec: cachev1alpha1.N8nSpec{
+					BinaryData: &cachev1alpha1.BinaryDataConfig{
+						Mode: cachev1alpha1.BinaryDataModeS3,
+						S3:   &cachev1alpha1.S3Config{Endpoint: "s3.example.com", Bucket: "n8n"},
+					},
+				},
+			}
+			env := getBinaryDataEnvVars(n8n)
+			Expect(env).To(ContainElement(corev1.EnvVar{Name: "N8N_EXTERNAL_STORAGE_S3_AUTH_AUTO_DETECT", Value: "true"}))
+			Expect(env).NotTo(ContainElement(HaveField("Name", "N8N_EXTERNAL_STORAGE_S3_ACCESS_KEY")))
+		})
+	})
+
+	Context("When reconciling a resource with external secrets", func() {
+		It("should wait for the referenced Secrets and for n8n", func() {
+			By("creating the custom resource referencing a missing token Secret")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{
+						Enable: true,
+						Url:    "test.example.com",
+					},
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+							Ssl:      false,
+						},
+					},
+					Auth: &cachev1alpha1.AuthConfig{
+						AdminCredentialsSecret: &cachev1alpha1.AdminCredentialsSecret{Name: "n8n-owner"},
+					},
+					ExternalSecrets: &cachev1alpha1.ExternalSecretsConfig{
+						Enable:   true,
+						Provider: cachev1alpha1.ExternalSecretsProviderInfisical,
+						Infisical: &cachev1alpha1.InfisicalConfig{
+							TokenSecret: cachev1alpha1.SecretKeyRef{
+								Name: "n8n-infisical",
+								Key:  "token",
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Verify the condition reports the missing Secret
+			Eventually(func() string {
+				n8n := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, n8n); err != nil {
+					return ""
+				}
+				cond := meta.FindStatusCondition(n8n.Status.Conditions, typeExternalSecretsReadyN8n)
+				if cond == nil {
+					return ""
+				}
+				return cond.Reason
+			}, time.Second*5, time.Millisecond*100).Should(Equal("SecretNotFound"))
+
+			By("creating the token Secret")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "n8n-infisical",
+					Namespace: "default",
+				},
+				StringData: map[string]string{"token": "st.123"},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Verify the provider isn't reported ready before n8n confirmed the connection
+			Eventually(func() string {
+				n8n := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, n8n); err != nil {
+					return ""
+				}
+				cond := meta.FindStatusCondition(n8n.Status.Conditions, typeExternalSecretsReadyN8n)
+				if cond == nil || cond.Status != metav1.ConditionUnknown {
+					return ""
+				}
+				return cond.Reason
+			}, time.Second*5, time.Millisecond*100).Should(Equal("WaitingForN8n"))
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should connect the provider only once n8n tested the settings", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n-vault", Namespace: "default"},
+				StringData: map[string]string{"token": "hvs.valid"},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			defer func() { Expect(k8sClient.Delete(ctx, secret)).To(Succeed()) }()
+
+			var saved map[string]interface{}
+			connected := map[string]bool{"infisical": true}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				switch {
+				case req.Method == http.MethodPost && req.URL.Path == "/rest/external-secrets/providers/vault/test":
+					settings := map[string]interface{}{}
+					Expect(json.NewDecoder(req.Body).Decode(&settings)).To(Succeed())
+					if settings["token"] != "hvs.valid" {
+						w.WriteHeader(http.StatusBadRequest)
+						_, _ = w.Write([]byte(`{"data":{"success":false,"testState":"error","error":"permission denied"}}`))
+						return
+					}
+					_, _ = w.Write([]byte(`{"data":{"success":true,"testState":"connected"}}`))
+				case req.Method == http.MethodPost && req.URL.Path == "/rest/external-secrets/providers/vault":
+					Expect(json.NewDecoder(req.Body).Decode(&saved)).To(Succeed())
+					_, _ = w.Write([]byte(`{"data":{}}`))
+				case req.Method == http.MethodGet && req.URL.Path == "/rest/external-secrets/providers":
+					_, _ = w.Write([]byte(`{"data":[{"name":"vault","connected":false},{"name":"infisical","connected":true}]}`))
+				case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/connect"):
+					body := map[string]bool{}
+					Expect(json.NewDecoder(req.Body).Decode(&body)).To(Succeed())
+					provider := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/rest/external-secrets/providers/"), "/connect")
+					connected[provider] = body["connected"]
+					_, _ = w.Write([]byte(`{"data":{}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n", Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					ExternalSecrets: &cachev1alpha1.ExternalSecretsConfig{
+						Enable:   true,
+						Provider: cachev1alpha1.ExternalSecretsProviderVault,
+						Vault: &cachev1alpha1.VaultConfig{
+							URL:         "https://vault.example.com:8200",
+							TokenSecret: cachev1alpha1.SecretKeyRef{Name: "n8n-vault", Key: "token"},
+						},
+					},
+				},
+			}
+
+			By("applying settings n8n can connect with")
+			message, err := reconciler.applyExternalSecrets(ctx, n8n, newN8nAPIClient(server.URL))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(message).To(BeEmpty())
+			Expect(saved).To(HaveKeyWithValue("url", "https://vault.example.com:8200"))
+			Expect(saved).To(HaveKeyWithValue("authMethod", "token"))
+			Expect(connected).To(Equal(map[string]bool{"vault": true, "infisical": false}))
+
+			By("applying a token n8n fails to connect with")
+			saved = nil
+			secret.StringData = map[string]string{"token": "hvs.revoked"}
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+			Eventually(func() (string, error) {
+				return reconciler.applyExternalSecrets(ctx, n8n, newN8nAPIClient(server.URL))
+			}, time.Second*5, time.Millisecond*100).Should(Equal("permission denied"))
+			Expect(saved).To(BeNil())
+		})
+
+		It("should not pass provider settings as environment variables", func() {
+			n8n := &cachev1alpha1.N8n{
+				Spec: cachev1alpha1.N8nSpec{
+					ExternalSecrets: &cachev1alpha1.ExternalSecretsConfig{
+						Enable:         true,
+						Provider:       cachev1alpha1.ExternalSecretsProviderVault,
+						UpdateInterval: 60,
+						Vault: &cachev1alpha1.VaultConfig{
+							URL:          "https://vault.example.com:8200",
+							TokenSecret:  cachev1alpha1.SecretKeyRef{Name: "n8n-vault", Key: "token"},
+							CACertSecret: &cachev1alpha1.SecretKeyRef{Name: "vault-ca", Key: "ca.crt"},
+						},
+					},
+				},
+			}
+			Expect(getExternalSecretsEnvVars(n8n)).To(ConsistOf(
+				corev1.EnvVar{Name: "N8N_EXTERNAL_SECRETS_UPDATE_INTERVAL", Value: "60"},
+				corev1.EnvVar{Name: "NODE_EXTRA_CA_CERTS", Value: "/etc/n8n/external-secrets/vault-ca.crt"},
+			))
+		})
+	})
+
+	Context("When managing the encryption key", func() {
+		It("should generate the key without a license and never replace it", func() {
+			keyName := types.NamespacedName{Name: resourceName + "-encryption-key", Namespace: "default"}
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+			_ = k8sClient.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: keyName.Name, Namespace: "default"}})
+
+			By("creating the custom resource without a license")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Verify the key is generated and passed to n8n
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, keyName, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKey("encryptionKey"))
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+				secretEnvVar("N8N_ENCRYPTION_KEY", keyName.Name, "encryptionKey")))
+
+			By("losing the key Secret")
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+			Eventually(func() string {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				n8n := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, n8n); err != nil {
+					return ""
+				}
+				condition := meta.FindStatusCondition(n8n.Status.Conditions, typeAvailableN8n)
+				if condition == nil {
+					return ""
+				}
+				return condition.Reason
+			}, time.Second*10, time.Millisecond*100).Should(Equal(reasonEncryptionKeyMissing))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, keyName, &corev1.Secret{}))).To(BeTrue())
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, deployment)).To(Succeed())
+		})
+
+		It("should only pass the activation settings for a license", func() {
+			autoRenew := false
+			n8n := &cachev1alpha1.N8n{
+				Spec: cachev1alpha1.N8nSpec{
+					License: &cachev1alpha1.LicenseConfig{
+						Enable:              true,
+						ActivationKeySecret: &cachev1alpha1.SecretKeyRef{Name: "n8n-license", Key: "activationKey"},
+						AutoRenew:           &autoRenew,
+					},
+				},
+			}
+			Expect(getLicenseEnvVars(n8n)).To(ConsistOf(
+				corev1.EnvVar{Name: "N8N_LICENSE_AUTO_RENEW_ENABLED", Value: "false"},
+				secretEnvVar("N8N_LICENSE_ACTIVATION_KEY", "n8n-license", "activationKey"),
+			))
+		})
+
+		It("should report the features and quota of the license", func() {
+			owner := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n-license-owner", Namespace: "default"},
+				StringData: map[string]string{"email": "owner@example.com", "password": "secret"},
+			}
+			Expect(k8sClient.Create(ctx, owner)).To(Succeed())
+			defer func() { Expect(k8sClient.Delete(ctx, owner)).To(Succeed()) }()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch {
+				case req.Method == http.MethodGet && req.URL.Path == "/rest/settings":
+					_, _ = w.Write([]byte(`{"data":{"license":{"planName":"Enterprise"},"enterprise":{"saml":true,"ldap":false,"sharing":true}}}`))
+				case req.Method == http.MethodPost && req.URL.Path == "/rest/login":
+					http.SetCookie(w, &http.Cookie{Name: "n8n-auth", Value: "owner"})
+					_, _ = w.Write([]byte(`{"data":{}}`))
+				case req.Method == http.MethodGet && req.URL.Path == "/rest/license":
+					if cookie, err := req.Cookie("n8n-auth"); err != nil || cookie.Value != "owner" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					_, _ = w.Write([]byte(`{"data":{"usage":{"activeWorkflowTriggers":{"value":3,"limit":-1}}}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n", Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					License: &cachev1alpha1.LicenseConfig{Enable: true},
+					Auth: &cachev1alpha1.AuthConfig{
+						AdminCredentialsSecret: &cachev1alpha1.AdminCredentialsSecret{
+							Name: "n8n-license-owner", EmailKey: "email", PasswordKey: "password",
+						},
+						SAML: &cachev1alpha1.SAMLConfig{Enable: true},
+						LDAP: &cachev1alpha1.LDAPConfig{Enable: true},
+					},
+				},
+			}
+			license, err := reconciler.readLicenseStatus(ctx, n8n, server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(license.Plan).To(Equal("Enterprise"))
+			Expect(license.Features).To(Equal([]string{"saml", "sharing"}))
+			Expect(license.MissingFeatures).To(Equal([]string{"ldap"}))
+			Expect(license.ActiveWorkflowTriggers).To(HaveValue(BeEquivalentTo(3)))
+			Expect(license.ActiveWorkflowTriggersLimit).To(HaveValue(BeEquivalentTo(-1)))
+		})
+	})
+
+	Context("When applying identity provider settings", func() {
+		It("should set up the owner and apply the settings again once the metadata changes", func() {
+			owner := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n-auth-owner", Namespace: "default"},
+				StringData: map[string]string{"email": "owner@example.com", "password": "Secret123"},
+			}
+			Expect(k8sClient.Create(ctx, owner)).To(Succeed())
+			defer func() { Expect(k8sClient.Delete(ctx, owner)).To(Succeed()) }()
+			metadata := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "idp-metadata", Namespace: "default"},
+				Data:       map[string]string{"metadata.xml": "<EntityDescriptor/>"},
+			}
+			Expect(k8sClient.Create(ctx, metadata)).To(Succeed())
+			defer func() { Expect(k8sClient.Delete(ctx, metadata)).To(Succeed()) }()
+
+			var setup, saml, oidc map[string]interface{}
+			ownerSet, logins := false, 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				switch {
+				case req.Method == http.MethodGet && req.URL.Path == "/rest/settings":
+					_, _ = fmt.Fprintf(w, `{"data":{"userManagement":{"showSetupOnFirstLoad":%t}}}`, !ownerSet)
+				case req.Method == http.MethodPost && req.URL.Path == "/rest/owner/setup":
+					Expect(json.NewDecoder(req.Body).Decode(&setup)).To(Succeed())
+					ownerSet = true
+					http.SetCookie(w, &http.Cookie{Name: "n8n-auth", Value: "owner"})
+					_, _ = w.Write([]byte(`{"data":{}}`))
+				case req.Method == http.MethodPost && req.URL.Path == "/rest/login" && ownerSet:
+					logins++
+					http.SetCookie(w, &http.Cookie{Name: "n8n-auth", Value: "owner"})
+					_, _ = w.Write([]byte(`{"data":{}}`))
+				case req.Method == http.MethodPost && req.URL.Path == "/rest/sso/saml/config":
+					if _, err := req.Cookie("n8n-auth"); err != nil {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					Expect(json.NewDecoder(req.Body).Decode(&saml)).To(Succeed())
+					_, _ = w.Write([]byte(`{"data":{}}`))
+				case req.Method == http.MethodGet && req.URL.Path == "/rest/sso/oidc/config":
+					_, _ = w.Write([]byte(`{"data":{"clientId":"n8n","discoveryEndpoint":"https://idp.example.com","loginEnabled":true}}`))
+				case req.Method == http.MethodPost && req.URL.Path == "/rest/sso/oidc/config":
+					Expect(json.NewDecoder(req.Body).Decode(&oidc)).To(Succeed())
+					_, _ = w.Write([]byte(`{"data":{}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n", Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					Auth: &cachev1alpha1.AuthConfig{
+						AdminCredentialsSecret: &cachev1alpha1.AdminCredentialsSecret{
+							Name: "n8n-auth-owner", EmailKey: "email", PasswordKey: "password",
+						},
+						SAML: &cachev1alpha1.SAMLConfig{
+							Enable:            true,
+							MetadataConfigMap: &cachev1alpha1.ConfigMapKeyRef{Name: "idp-metadata", Key: "metadata.xml"},
+						},
+					},
+				},
+			}
+
+			By("setting up the owner of a fresh instance")
+			apiClient, err := reconciler.ownerClient(ctx, n8n, server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(setup).To(HaveKeyWithValue("email", "owner@example.com"))
+			Expect(setup).To(HaveKeyWithValue("password", "Secret123"))
+			Expect(reconciler.applyAuth(ctx, n8n, apiClient)).To(Succeed())
+			Expect(saml).To(HaveKeyWithValue("metadata", "<EntityDescriptor/>"))
+			Expect(saml).To(HaveKeyWithValue("loginEnabled", true))
+
+			By("logging in once the owner exists")
+			_, err = reconciler.ownerClient(ctx, n8n, server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logins).To(Equal(1))
+
+			By("disabling the login of a provider removed from the spec")
+			n8n.Status.AuthProviders = []string{"oidc", "saml"}
+			Expect(droppedAuthProviders(n8n)).To(Equal([]string{"oidc"}))
+			Expect(apiClient.disableAuthProviders(ctx, droppedAuthProviders(n8n))).To(Succeed())
+			Expect(oidc).To(HaveKeyWithValue("loginEnabled", false))
+			Expect(oidc).To(HaveKeyWithValue("clientId", "n8n"))
+
+			By("fingerprinting the metadata the settings are read from")
+			referenced, problem, err := reconciler.authReferences(ctx, n8n)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(problem).To(BeEmpty())
+			applied := appliedConfigHash(n8n.Spec.Auth, referenced)
+			metadata.Data["metadata.xml"] = "<EntityDescriptor entityID=\"idp\"/>"
+			Expect(k8sClient.Update(ctx, metadata)).To(Succeed())
+			Eventually(func() (string, error) {
+				referenced, _, err := reconciler.authReferences(ctx, n8n)
+				return appliedConfigHash(n8n.Spec.Auth, referenced), err
+			}, time.Second*5, time.Millisecond*100).ShouldNot(Equal(applied))
+
+			By("reporting a missing metadata ConfigMap")
+			n8n.Spec.Auth.SAML.MetadataConfigMap.Name = "missing-metadata"
+			_, problem, err = reconciler.authReferences(ctx, n8n)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(problem).To(Equal("ConfigMap missing-metadata was not found"))
+		})
+	})
+
+	Context("When reconciling a resource with autoscaling", func() {
+		It("should scale queue mode workers and protect them with a PodDisruptionBudget", func() {
+			By("creating the custom resource with autoscaling enabled")
+			cpu := int32(75)
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{
+						Enable: true,
+						Url:    "test.example.com",
+					},
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+							Ssl:      false,
+						},
+					},
+					BinaryData: &cachev1alpha1.BinaryDataConfig{
+						Mode: cachev1alpha1.BinaryDataModeS3,
+						S3: &cachev1alpha1.S3Config{
+							Endpoint: "s3.example.com",
+							Bucket:   "n8n",
+						},
+					},
+					Autoscaling: &cachev1alpha1.AutoscalingConfig{
+						Enable:                         true,
+						MinReplicas:                    2,
+						MaxReplicas:                    5,
+						TargetCPUUtilizationPercentage: &cpu,
+						Queue: &cachev1alpha1.QueueScalingConfig{
+							Enable:       true,
+							RedisAddress: "redis.default.svc:6380",
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Verify the main instance stays single and hands executions to the workers
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Replicas).To(HaveValue(BeEquivalentTo(1)))
+			Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
+				corev1.EnvVar{Name: "EXECUTIONS_MODE", Value: "queue"},
+				corev1.EnvVar{Name: "QUEUE_BULL_REDIS_HOST", Value: "redis.default.svc"},
+				corev1.EnvVar{Name: "QUEUE_BULL_REDIS_PORT", Value: "6380"},
+			))
+
+			workers := &appsv1.Deployment{}
+			workerName := types.NamespacedName{Name: resourceName + "-worker", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, workerName, workers)).To(Succeed())
+			Expect(workers.Spec.Selector.MatchLabels).To(HaveKeyWithValue("app.kubernetes.io/name", "n8n-worker"))
+			Expect(workers.Spec.Template.Spec.Containers[0].Command).To(Equal([]string{"tini", "--", "/docker-entrypoint.sh", "worker"}))
+			Expect(workers.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "EXECUTIONS_MODE", Value: "queue"}))
+
+			// Verify the HorizontalPodAutoscaler targets the workers
+			Eventually(func() bool {
+				hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, hpa); err != nil {
+					return false
+				}
+				return hpa.Spec.ScaleTargetRef.Name == resourceName+"-worker" &&
+					*hpa.Spec.MinReplicas == 2 &&
+					hpa.Spec.MaxReplicas == 5 &&
+					len(hpa.Spec.Metrics) == 1
+			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+
+			// Verify the workers are protected by a PodDisruptionBudget
+			Eventually(func() bool {
+				pdb := &policyv1.PodDisruptionBudget{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, pdb); err != nil {
+					return false
+				}
+				return pdb.Spec.MaxUnavailable != nil && pdb.Spec.MaxUnavailable.IntValue() == 1 &&
+					pdb.Spec.Selector.MatchLabels["app.kubernetes.io/name"] == "n8n-worker"
+			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, workers)).To(Succeed())
+		})
+
+		It("should reject autoscaling without queue mode", func() {
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+						},
+					},
+					Autoscaling: &cachev1alpha1.AutoscalingConfig{
+						Enable:      true,
+						MaxReplicas: 5,
+					},
+				},
+			}
+			err := k8sClient.Create(ctx, resource)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("only queue mode workers can be scaled"))
+		})
+
+		It("should reject filesystem binary data shared with workers without shared storage", func() {
+			n8n := &cachev1alpha1.N8n{
+				Spec: cachev1alpha1.N8nSpec{
+					Autoscaling: &cachev1alpha1.AutoscalingConfig{
+						Enable:      true,
+						MaxReplicas: 3,
+						Queue:       &cachev1alpha1.QueueScalingConfig{Enable: true, RedisAddress: "redis:6379"},
+					},
+				},
+			}
+			By("Accepting the default mode when binary data is not configured")
+			Expect(validateBinaryData(n8n, false)).To(Succeed())
+
+			By("Refusing an explicit filesystem mode")
+			n8n.Spec.BinaryData = &cachev1alpha1.BinaryDataConfig{Mode: cachev1alpha1.BinaryDataModeFilesystem}
+			Expect(validateBinaryData(n8n, false)).To(MatchError(ContainSubstring("requires shared storage when running up to 4 n8n pods")))
+			Expect(validateBinaryData(n8n, true)).To(Succeed())
+		})
+	})
+
+	Context("When reconciling a resource with a disruption budget", func() {
+		It("should only protect the pods of the instance", func() {
+			enable := true
+			minAvailable := intstr.FromInt32(1)
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+						},
+					},
+					Disruption: &cachev1alpha1.DisruptionConfig{
+						Enable:       &enable,
+						MinAvailable: &minAvailable,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			pdb := &policyv1.PodDisruptionBudget{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, pdb)).To(Succeed())
+			Expect(pdb.Spec.Selector.MatchLabels).To(HaveKeyWithValue("app.kubernetes.io/instance", resourceName))
+			Expect(pdb.Spec.MinAvailable).To(HaveValue(Equal(minAvailable)))
+			Expect(pdb.Spec.MaxUnavailable).To(BeNil())
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, pdb)).To(Succeed())
+		})
+	})
+
+	Context("When upgrading n8n", func() {
+		It("should back up, roll out with Recreate and roll back a failed rollout", func() {
+			jobName := types.NamespacedName{Name: resourceName + "-upgrade-1-86-0", Namespace: "default"}
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+
+			By("creating the custom resource pinned to a version")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+						},
+					},
+					Version: "1.85.0",
+					Upgrade: &cachev1alpha1.UpgradeConfig{Backup: true},
+					Backup:  &cachev1alpha1.BackupConfig{ClaimName: "n8n-backups"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			reconcileUntil := func(check func(*cachev1alpha1.N8n, *appsv1.Deployment) bool) {
+				Eventually(func() bool {
+					_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+						NamespacedName: typeNamespacedName,
+					})
+					n8n := &cachev1alpha1.N8n{}
+					dep := &appsv1.Deployment{}
+					if k8sClient.Get(ctx, typeNamespacedName, n8n) != nil || k8sClient.Get(ctx, typeNamespacedName, dep) != nil {
+						return false
+					}
+					return check(n8n, dep)
+				}, time.Second*10, time.Millisecond*100).Should(BeTrue())
+			}
+			setVersion := func(version string) {
+				Eventually(func() error {
+					updated := &cachev1alpha1.N8n{}
+					if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
+						return err
+					}
+					updated.Spec.Version = version
+					return k8sClient.Update(ctx, updated)
+				}, time.Second*5, time.Millisecond*100).Should(Succeed())
+			}
+
+			reconcileUntil(func(n8n *cachev1alpha1.N8n, _ *appsv1.Deployment) bool {
+				return n8n.Status.Version == "1.85.0"
+			})
+
+			By("changing the version")
+			setVersion("1.86.0")
+			reconcileUntil(func(_ *cachev1alpha1.N8n, _ *appsv1.Deployment) bool {
+				return k8sClient.Get(ctx, jobName, &batchv1.Job{}) == nil
+			})
+			dep := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dep)).To(Succeed())
+			Expect(n8nContainer(dep).Image).To(Equal(n8nImage("1.85.0")))
+
+			By("completing the backup")
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, jobName, job)).To(Succeed())
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			job.Status.CompletionTime = &now
+			job.Status.Succeeded = 1
+			job.Status.Conditions = []batchv1.JobCondition{{
+				Type:               batchv1.JobComplete,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: now,
+			}}
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+			reconcileUntil(func(_ *cachev1alpha1.N8n, dep *appsv1.Deployment) bool {
+				return n8nContainer(dep).Image == n8nImage("1.86.0") &&
+					dep.Spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType
+			})
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, jobName, &batchv1.Job{}))).To(BeTrue())
+
+			By("failing the rollout")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, dep)).To(Succeed())
+			dep.Status.Conditions = []appsv1.DeploymentCondition{{
+				Type:   appsv1.DeploymentProgressing,
+				Status: corev1.ConditionFalse,
+				Reason: "ProgressDeadlineExceeded",
+			}}
+			Expect(k8sClient.Status().Update(ctx, dep)).To(Succeed())
+			reconcileUntil(func(n8n *cachev1alpha1.N8n, _ *appsv1.Deployment) bool {
+				failed := meta.FindStatusCondition(n8n.Status.Conditions, typeUpgradeFailedN8n)
+				return failed != nil && failed.Reason == "RolloutFailed"
+			})
+
+			By("rolling back")
+			Eventually(func() error {
+				updated := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
+					return err
+				}
+				if updated.Annotations == nil {
+					updated.Annotations = map[string]string{}
+				}
+				updated.Annotations[rollbackAnnotation] = "true"
+				return k8sClient.Update(ctx, updated)
+			}, time.Second*5, time.Millisecond*100).Should(Succeed())
+			reconcileUntil(func(n8n *cachev1alpha1.N8n, dep *appsv1.Deployment) bool {
+				return n8n.Spec.Version == "1.85.0" && n8nContainer(dep).Image == n8nImage("1.85.0")
+			})
+
+			By("retrying the upgrade")
+			setVersion("1.86.0")
+			reconcileUntil(func(_ *cachev1alpha1.N8n, _ *appsv1.Deployment) bool {
+				return k8sClient.Get(ctx, jobName, &batchv1.Job{}) == nil
+			})
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+			_ = k8sClient.Delete(ctx, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: jobName.Name, Namespace: "default"}},
+				client.PropagationPolicy(metav1.DeletePropagationBackground))
+		})
+	})
+
+	Context("When reconciling a suspended resource", func() {
+		It("should scale n8n to zero and serve the maintenance page", func() {
+			By("creating the custom resource with suspend set")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{
+						Enable: true,
+						Url:    "test.example.com",
+					},
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+							Ssl:      false,
+						},
+					},
+					Suspend: true,
+					MaintenancePage: &cachev1alpha1.MaintenancePageConfig{
+						Enable: true,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Verify the n8n Deployment is scaled to zero
+			Eventually(func() bool {
+				dep := &appsv1.Deployment{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, dep); err != nil {
+					return false
+				}
+				return dep.Spec.Replicas != nil && *dep.Spec.Replicas == 0
+			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+
+			// Verify the Service routes to the maintenance page
+			Eventually(func() bool {
+				svc := &corev1.Service{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, svc); err != nil {
+					return false
+				}
+				return svc.Spec.Selector["app.kubernetes.io/name"] == "n8n-maintenance"
+			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+
+			// Verify the Suspended condition
+			n8n := &cachev1alpha1.N8n{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, n8n)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(n8n.Status.Conditions, typeSuspendedN8n)).To(BeTrue())
+
+			By("changing the maintenance message")
+			pageKey := types.NamespacedName{Name: maintenancePageName(n8n), Namespace: "default"}
+			page := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, pageKey, page)).To(Succeed())
+			previous := page.Spec.Template.Annotations[maintenancePageAnnotation]
+			Eventually(func() error {
+				updated := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
+					return err
+				}
+				updated.Spec.MaintenancePage.Message = "Back at noon"
+				return k8sClient.Update(ctx, updated)
+			}, time.Second*5, time.Millisecond*100).Should(Succeed())
+
+			// Verify the maintenance pods are rolled to serve the new message
+			Eventually(func() string {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				if err := k8sClient.Get(ctx, pageKey, page); err != nil {
+					return previous
+				}
+				return page.Spec.Template.Annotations[maintenancePageAnnotation]
+			}, time.Second*10, time.Millisecond*100).ShouldNot(Equal(previous))
+			cm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, pageKey, cm)).To(Succeed())
+			Expect(cm.Data["index.html"]).To(ContainSubstring("Back at noon"))
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+	})
+
+	Context("When checking n8n version changes", func() {
+		It("should refuse unsupported jumps", func() {
+			_, err := checkVersionChange("1.85.3", "1.80.0", false)
+			Expect(err).To(HaveOccurred())
+			_, err = checkVersionChange("1.85.3", "3.0.0", false)
+			Expect(err).To(HaveOccurred())
+
+			warning, err := checkVersionChange("0.236.0", "1.0.0", false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warning).To(ContainSubstring("review the breaking changes"))
+
+			warning, err = checkVersionChange("1.85.3", "1.80.0", true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warning).NotTo(BeEmpty())
+			warning, err = checkVersionChange("1.85.3", "1.86.0", false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warning).To(BeEmpty())
+		})
+
+		It("should follow releases allowed by the upgrade policy", func() {
+			Expect(upgradePolicyAllows(cachev1alpha1.UpgradePolicyPatch, "1.85.0", "1.85.3")).To(BeTrue())
+			Expect(upgradePolicyAllows(cachev1alpha1.UpgradePolicyPatch, "1.85.0", "1.86.0")).To(BeFalse())
+			Expect(upgradePolicyAllows(cachev1alpha1.UpgradePolicyMinor, "1.85.0", "1.86.0")).To(BeTrue())
+			Expect(upgradePolicyAllows(cachev1alpha1.UpgradePolicyMinor, "1.85.0", "2.0.0")).To(BeFalse())
+			Expect(upgradePolicyAllows(cachev1alpha1.UpgradePolicyManual, "1.85.0", "1.85.3")).To(BeFalse())
+			Expect(upgradePolicyAllows(cachev1alpha1.UpgradePolicyPatch, "1.85.3", "1.85.0")).To(BeFalse())
+		})
+	})
+
+	Context("When building n8n URLs", func() {
+		It("should include the protocol, non-default ports and the sub-path", func() {
+			n8n := &cachev1alpha1.N8n{
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{Enable: true, Url: "n8n.example.com", Path: "n8n"},
+				},
+			}
+			Expect(pathForN8n(n8n)).To(Equal("/n8n/"))
+
+			urls := n8nURLs{protocol: "https", port: 443, path: pathForN8n(n8n)}
+			Expect(urls.url("n8n.example.com")).To(Equal("https://n8n.example.com/n8n/"))
+			urls = n8nURLs{protocol: "http", port: 8080, path: "/"}
+			Expect(urls.url("n8n.example.com")).To(Equal("http://n8n.example.com:8080/"))
+			Expect(urls.url("")).To(BeEmpty())
+		})
+
+		It("should only consider the listeners the HTTPRoute attaches to", func() {
+			hostname := gatewayv1.Hostname("*.example.com")
+			gateway := &gatewayv1.Gateway{
+				Spec: gatewayv1.GatewaySpec{
+					Listeners: []gatewayv1.Listener{
+						{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 8080, Hostname: &hostname},
+						{Name: "https", Protocol: gatewayv1.HTTPSProtocolType, Port: 8443, Hostname: &hostname},
+					},
+				},
+			}
+			Expect(listenerForHost(gateway, cachev1alpha1.GatewayRef{}, "n8n.example.com").Name).To(
+				Equal(gatewayv1.SectionName("https")))
+			Expect(listenerForHost(gateway, cachev1alpha1.GatewayRef{SectionName: "http"}, "n8n.example.com").Name).To(
+				Equal(gatewayv1.SectionName("http")))
+			port := int32(8080)
+			Expect(listenerForHost(gateway, cachev1alpha1.GatewayRef{Port: &port}, "n8n.example.com").Name).To(
+				Equal(gatewayv1.SectionName("http")))
+			Expect(listenerForHost(gateway, cachev1alpha1.GatewayRef{}, "n8n.other.com")).To(BeNil())
+		})
+
+		It("should refuse a sub-path with routing", func() {
+			n8n := &cachev1alpha1.N8n{
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{Path: "/n8n/"},
+					Routing: &cachev1alpha1.RoutingConfig{
+						Editor: cachev1alpha1.EndpointConfig{Hostname: "n8n.example.com"},
+						Webhook: cachev1alpha1.WebhookEndpointConfig{
+							EndpointConfig: cachev1alpha1.EndpointConfig{Hostname: "hooks.example.com"},
+						},
+					},
+				},
+			}
+			Expect(validateExposure(n8n)).To(MatchError(ContainSubstring("remove hostname.path")))
+
+			n8n.Spec.Hostname.Path = "/"
+			Expect(validateExposure(n8n)).To(Succeed())
+		})
+
+		It("should refuse an Ingress path that doesn't route the n8n path", func() {
+			n8n := &cachev1alpha1.N8n{
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{Enable: true, Url: "n8n.example.com", Path: "/n8n/"},
+					Ingress:  &cachev1alpha1.IngressConfig{Enable: true, Path: "/automation"},
+				},
+			}
+			Expect(validateExposure(n8n)).To(MatchError(ContainSubstring("differs from the n8n path /n8n/")))
+
+			n8n.Spec.Ingress.Path = "/n8n"
+			Expect(validateExposure(n8n)).To(Succeed())
+
+			By("requiring implementation specific paths to start with the n8n path")
+			n8n.Spec.Ingress.PathType = "ImplementationSpecific"
+			n8n.Spec.Ingress.Path = "/n8n(/|$)(.*)"
+			Expect(validateExposure(n8n)).To(Succeed())
+			n8n.Spec.Ingress.Path = "/automation(/|$)(.*)"
+			Expect(validateExposure(n8n)).To(MatchError(ContainSubstring("must start with the n8n path")))
+		})
+	})
+
+	Context("When restricting traffic with a NetworkPolicy", func() {
+		It("should select the pods of the instance and admit the operator", func() {
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					NetworkPolicy: &cachev1alpha1.NetworkPolicyConfig{Enable: true},
+				},
+			}
+			np, err := reconciler.networkPolicyForN8n(ctx, n8n)
+			Expect(err).NotTo(HaveOccurred())
+
+			selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selector.Matches(labels.Set(instanceLabelsForN8n(n8n)))).To(BeTrue())
+			Expect(selector.Matches(labels.Set(workerLabels(n8n)))).To(BeTrue())
+			other := &cachev1alpha1.N8n{ObjectMeta: metav1.ObjectMeta{Name: "other"}}
+			Expect(selector.Matches(labels.Set(instanceLabelsForN8n(other)))).To(BeFalse())
+			Expect(selector.Matches(labels.Set(maintenancePageLabels(n8n)))).To(BeFalse())
+
+			// The manager pods are only labeled with the control plane
+			Expect(np.Spec.Ingress[0].From).To(ContainElement(networkingv1.NetworkPolicyPeer{
+				NamespaceSelector: &metav1.LabelSelector{},
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"control-plane": "controller-manager"},
+				},
+			}))
+		})
+	})
+
+	Context("When configuring metrics", func() {
+		It("should select the Service and enable the included metrics", func() {
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n", Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					Metrics: &cachev1alpha1.MetricsConfig{
+						Enable: true,
+						ServiceMonitor: &cachev1alpha1.MonitorConfig{
+							Interval: "30s",
+							Labels:   map[string]string{"release": "prometheus"},
+						},
+						Include: &cachev1alpha1.MetricsIncludeConfig{WorkflowIDLabel: true},
+					},
+				},
+			}
+			sm, err := reconciler.serviceMonitorForN8n(n8n)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sm.Labels).To(HaveKeyWithValue("release", "prometheus"))
+			Expect(sm.Spec.Endpoints[0].Interval).To(Equal(monitoringv1.Duration("30s")))
+			svc := reconciler.serviceForN8n(n8n)
+			for key, value := range sm.Spec.Selector.MatchLabels {
+				Expect(svc.Labels).To(HaveKeyWithValue(key, value))
+			}
+			Expect(getMetricsEnvVars(n8n)).To(ConsistOf(
+				corev1.EnvVar{Name: "N8N_METRICS_INCLUDE_WORKFLOW_ID_LABEL", Value: "true"}))
+		})
+	})
+
+	Context("When exposing n8n through an OpenShift Route", func() {
+		It("should serve TLS from n8n only when the router doesn't terminate it", func() {
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n", Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					Route: &cachev1alpha1.RouteConfig{
+						Enable: true,
+						TLS:    &cachev1alpha1.RouteTLS{Termination: cachev1alpha1.RouteTerminationEdge},
+					},
+				},
+			}
+			Expect(servingTLS(n8n)).To(BeFalse())
+			Expect(n8nServiceURL(n8n)).To(Equal("http://n8n.default.svc:80"))
+
+			n8n.Spec.Route.TLS.Termination = cachev1alpha1.RouteTerminationReencrypt
+			Expect(servingTLS(n8n)).To(BeTrue())
+			Expect(serviceCAIssuesServingCert(n8n)).To(BeTrue())
+			Expect(servingCertSecretName(n8n)).To(Equal("n8n-serving-cert"))
+			Expect(n8nServiceURL(n8n)).To(Equal("https://n8n.default.svc:80"))
+		})
+
+		It("should leave out the path of passthrough Routes", func() {
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{Name: "n8n", Namespace: "default"},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{Enable: true, Url: "n8n.apps.example.com"},
+					Route: &cachev1alpha1.RouteConfig{
+						Enable: true,
+						TLS: &cachev1alpha1.RouteTLS{
+							Termination:       cachev1alpha1.RouteTerminationPassthrough,
+							ServingCertSecret: "n8n-tls",
+						},
+					},
+				},
+			}
+			Expect(validateExposure(n8n)).To(Succeed())
+			route, err := reconciler.routeForN8n(n8n)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(route.Object["spec"]).NotTo(HaveKey("path"))
+			termination, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "termination")
+			Expect(termination).To(Equal("passthrough"))
+			Expect(servingTLS(n8n)).To(BeTrue())
+			Expect(serviceCAIssuesServingCert(n8n)).To(BeFalse())
+
+			By("refusing a sub-path the router can't route")
+			n8n.Spec.Hostname.Path = "/n8n/"
+			Expect(validateExposure(n8n)).To(MatchError(ContainSubstring("passthrough Routes can't route a sub-path")))
+
+			By("keeping the path of edge Routes")
+			n8n.Spec.Route.TLS.Termination = cachev1alpha1.RouteTerminationEdge
+			Expect(validateExposure(n8n)).To(Succeed())
+			route, err = reconciler.routeForN8n(n8n)
+			Expect(err).NotTo(HaveOccurred())
+			path, _, _ := unstructured.NestedString(route.Object, "spec", "path")
+			Expect(path).To(Equal("/n8n/"))
+		})
+
+		It("should report whether a router admitted the Route", func() {
+			route := newUnstructured(routeGVK)
+			admitted, rejected := routeAdmission(route)
+			Expect(admitted).To(BeFalse())
+			Expect(rejected).To(BeEmpty())
+
+			route.Object["status"] = map[string]interface{}{
+				"ingress": []interface{}{
+					map[string]interface{}{
+						"routerName": "default",
+						"conditions": []interface{}{
+							map[string]interface{}{"type": "Admitted", "status": "False", "message": "host taken"},
+						},
+					},
+				},
+			}
+			admitted, rejected = routeAdmission(route)
+			Expect(admitted).To(BeFalse())
+			Expect(rejected).To(ConsistOf("router default: host taken"))
+		})
+	})
+
+	Context("When updating a resource", func() {
+		BeforeEach(func() {
+			By("creating the custom resource")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{
+						Enable: true,
+						Url:    "test.example.com",
+					},
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+							Ssl:      false,
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+		})
+
+		It("should handle spec updates", func() {
+			// Wait for initial reconciliation
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Update the resource with metrics enabled
+			Eventually(func() error {
+				updated := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, updated); err != nil {
+					return err
+				}
+				updated.Spec.Metrics = &cachev1alpha1.MetricsConfig{
+					Enable: true,
+				}
+				return k8sClient.Update(ctx, updated)
+			}, time.Second*5, time.Millisecond*100).Should(Succeed())
+
+			// Wait for reconciliation after update
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Verify ServiceMonitor is created
+			Eventually(func() bool {
+				sm := &monitoringv1.ServiceMonitor{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, sm); err != nil {
+					return false
+				}
+				return len(sm.Spec.Endpoints) == 1 &&
+					sm.Spec.Endpoints[0].Path == "/metrics"
+			}, time.Second*5, time.Millisecond*100).Should(BeTrue())
+		})
+	})
+
+	Context("When resource creation fails", func() {
+		It("should validate required fields", func() {
+			By("creating the custom resource with invalid configuration")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "", // Invalid empty host
+							Port:     0,  // Invalid port
+							Database: "", // Invalid empty database
+							User:     "", // Invalid empty user
+							Password: "", // Invalid empty password
+						},
+					},
+				},
+			}
+
+			err := k8sClient.Create(ctx, resource)
+			Expect(err).To(HaveOccurred())
+			statusErr, ok := err.(*errors.StatusError)
+			Expect(ok).To(BeTrue())
+			Expect(statusErr.Status().Code).To(Equal(int32(422)))
+			Expect(statusErr.Status().Reason).To(Equal(metav1.StatusReasonInvalid))
+			Expect(len(statusErr.Status().Details.Causes)).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("When deleting a resource", func() {
+		It("should handle deletion", func() {
+			By("creating the custom resource")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Hostname: &cachev1alpha1.HostnameConfig{
+						Enable: true,
+						Url:    "test.example.com",
+					},
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+							Ssl:      false,
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			// Wait for initial reconciliation
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return err
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			// Delete the resource
+			Eventually(func() error {
+				n8n := &cachev1alpha1.N8n{}
+				if err := k8sClient.Get(ctx, typeNamespacedName, n8n); err != nil {
+					return err
+				}
+				return k8sClient.Delete(ctx, n8n)
+			}, time.Second*5, time.Millisecond*100).Should(Succeed())
+
+			// Verify deletion handling
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, typeNamespacedName, &cachev1alpha1.N8n{})
+				return errors.IsNotFound(err)
+			}, time.Second*10, time.Millisecond*100).Should(BeTrue())
+		})
+
+		It("should keep the encryption key with the Retain policy", func() {
+			keyName := types.NamespacedName{Name: resourceName + "-encryption-key", Namespace: "default"}
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+			_ = k8sClient.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: keyName.Name, Namespace: "default"}})
+
+			By("creating the custom resource with the Retain policy")
+			resource := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Database: cachev1alpha1.Database{
+						Postgres: cachev1alpha1.Postgres{
+							Host:     "localhost",
+							Port:     5432,
+							Database: "n8n",
+							User:     "n8n",
+							Password: "n8n",
+						},
+					},
+					DeletionPolicy: cachev1alpha1.DeletionPolicyRetain,
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				if err != nil {
+					return err
+				}
+				return k8sClient.Get(ctx, keyName, &corev1.Secret{})
+			}, time.Second*10, time.Millisecond*100).Should(Succeed())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, keyName, secret)).To(Succeed())
+			Expect(secret.OwnerReferences).NotTo(BeEmpty())
+
+			By("deleting the resource")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			Eventually(func() bool {
+				_, _ = reconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				return errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &cachev1alpha1.N8n{}))
+			}, time.Second*10, time.Millisecond*100).Should(BeTrue())
+
+			// Verify the Secret is kept without the owner reference
+			Expect(k8sClient.Get(ctx, keyName, secret)).To(Succeed())
+			Expect(secret.OwnerReferences).To(BeEmpty())
+
+			// Cleanup
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+			_ = k8sClient.Delete(ctx, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}})
+		})
+
+		It("should name the final snapshot after the resource UID", func() {
+			n8n := &cachev1alpha1.N8n{ObjectMeta: metav1.ObjectMeta{Name: "n8n", UID: "0123abcd-4567-89ef-0123-456789abcdef"}}
+			Expect(finalSnapshotName(n8n)).To(Equal(dataClaimName(n8n) + "-final-0123abcd"))
+		})
+
+		It("should not let the resource being deleted own the final backup Job", func() {
+			now := metav1.Now()
+			n8n := &cachev1alpha1.N8n{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "n8n",
+					Namespace:         "default",
+					UID:               "0123abcd-4567-89ef-0123-456789abcdef",
+					DeletionTimestamp: &now,
+				},
+				Spec: cachev1alpha1.N8nSpec{
+					Backup: &cachev1alpha1.BackupConfig{ClaimName: "n8n-backups", BeforeDeletion: true},
+				},
+			}
+			Expect(finalBackupName(n8n)).To(Equal("n8n-final-backup-0123abcd"))
+			job, err := reconciler.backupJobForN8n(n8n, finalBackupName(n8n), "final")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.OwnerReferences).To(BeEmpty())
+			Expect(job.Labels).To(HaveKeyWithValue(instanceLabel, "n8n"))
+			Expect(job.Spec.TTLSecondsAfterFinished).To(HaveValue(BeEquivalentTo(finalBackupTTL.Seconds())))
+
+			By("owning the Job backing up before an upgrade")
+			n8n.DeletionTimestamp = nil
+			job, err = reconciler.backupJobForN8n(n8n, "n8n-pre-upgrade", "pre-1.86.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.OwnerReferences).To(HaveLen(1))
 		})
 	})
 })
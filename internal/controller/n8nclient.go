@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// n8nBrowserID identifies the operator to n8n, which binds auth cookies to a browser ID
+const n8nBrowserID = "n8n-operator"
+
+// n8nAPIBudget bounds the total time the n8n API calls of one reconciliation may take, so an unresponsive
+// instance doesn't hold up the reconciliation of the others
+const n8nAPIBudget = 15 * time.Second
+
+// serviceCAFile is where OpenShift mounts the CA issuing the serving certificates of Services
+const serviceCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
+
+// n8nHTTPClient is used to query the n8n instances managed by the operator
+var n8nHTTPClient = newN8nHTTPClient()
+
+// newN8nHTTPClient returns a client trusting the system CAs and, on OpenShift, the service CA that
+// issues the certificates n8n serves behind reencrypt Routes
+func newN8nHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if ca, err := os.ReadFile(serviceCAFile); err == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pool.AppendCertsFromPEM(ca)
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &http.Client{Timeout: 5 * time.Second, Transport: transport}
+}
+
+// n8nAPIDeadlineKey is the context key of the deadline shared by the n8n API calls of a reconciliation
+type n8nAPIDeadlineKey struct{}
+
+// withN8nAPIBudget returns a context whose n8n API calls together may take at most budget. Only the
+// API calls are bounded, requests to the Kubernetes API made with the context are not.
+func withN8nAPIBudget(ctx context.Context, budget time.Duration) context.Context {
+	return context.WithValue(ctx, n8nAPIDeadlineKey{}, time.Now().Add(budget))
+}
+
+// n8nServiceURL returns the in-cluster URL of the n8n Service
+func n8nServiceURL(n8n *n8nv1alpha1.N8n) string {
+	scheme := "http"
+	if servingTLS(n8n) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s.%s.svc:%d", scheme, n8n.Name, n8n.Namespace, servicePortForN8n(n8n))
+}
+
+// n8nSettings is the subset of the public n8n frontend settings read by the operator
+type n8nSettings struct {
+	Data struct {
+		License struct {
+			PlanName string `json:"planName"`
+		} `json:"license"`
+		Enterprise     map[string]interface{} `json:"enterprise"`
+		UserManagement struct {
+			ShowSetupOnFirstLoad bool `json:"showSetupOnFirstLoad"`
+		} `json:"userManagement"`
+	} `json:"data"`
+}
+
+// n8nAPIError is returned for responses with a status code outside of 2xx
+type n8nAPIError struct {
+	method     string
+	path       string
+	statusCode int
+	body       []byte
+}
+
+func (e *n8nAPIError) Error() string {
+	return fmt.Sprintf("%s %s returned status code %d: %s", e.method, e.path, e.statusCode, bytes.TrimSpace(e.body))
+}
+
+// n8nAPIClient talks to the internal REST API of an n8n instance
+type n8nAPIClient struct {
+	baseURL string
+	cookies []*http.Cookie
+}
+
+func newN8nAPIClient(baseURL string) *n8nAPIClient {
+	return &n8nAPIClient{baseURL: baseURL}
+}
+
+// do sends a JSON request and decodes the JSON response into out when it is not nil
+func (c *n8nAPIClient) do(ctx context.Context, method, path string, in, out interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	if deadline, ok := ctx.Value(n8nAPIDeadlineKey{}).(time.Time); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("browser-id", n8nBrowserID)
+	// Cookies are attached by hand since n8n marks them secure while the operator talks plain HTTP
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+
+	resp, err := n8nHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp, &n8nAPIError{method: method, path: path, statusCode: resp.StatusCode, body: msg}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// settings reads the public frontend settings
+func (c *n8nAPIClient) settings(ctx context.Context) (*n8nSettings, error) {
+	settings := &n8nSettings{}
+	if _, err := c.do(ctx, http.MethodGet, "/rest/settings", nil, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// login authenticates the client as the given n8n user
+func (c *n8nAPIClient) login(ctx context.Context, email, password string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/rest/login", map[string]string{
+		"emailOrLdapLoginId": email,
+		"password":           password,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	c.cookies = resp.Cookies()
+	return nil
+}
+
+// setupOwner creates the owner account of a fresh n8n instance and authenticates the client as it
+func (c *n8nAPIClient) setupOwner(ctx context.Context, email, password string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/rest/owner/setup", map[string]string{
+		"email":     email,
+		"firstName": "Instance",
+		"lastName":  "Owner",
+		"password":  password,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	c.cookies = resp.Cookies()
+	return nil
+}
+
+// n8nAvailable reports whether an n8n pod is ready to answer API requests
+func (r *N8nReconciler) n8nAvailable(ctx context.Context, n8n *n8nv1alpha1.N8n) (bool, error) {
+	dep := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: n8n.Name, Namespace: n8n.Namespace}, dep)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return dep.Status.AvailableReplicas > 0, nil
+}
+
+// ownerClient returns a client of the n8n API at baseURL logged in as the owner account
+// referenced by adminCredentialsSecret, setting the account up first while n8n has no owner
+func (r *N8nReconciler) ownerClient(ctx context.Context, n8n *n8nv1alpha1.N8n, baseURL string) (*n8nAPIClient, error) {
+	if n8n.Spec.Auth == nil || n8n.Spec.Auth.AdminCredentialsSecret == nil {
+		return nil, fmt.Errorf("auth.adminCredentialsSecret is not set")
+	}
+	creds := n8n.Spec.Auth.AdminCredentialsSecret
+	email, err := r.secretValue(ctx, n8n.Namespace, creds.Name, creds.EmailKey)
+	if err != nil {
+		return nil, err
+	}
+	password, err := r.secretValue(ctx, n8n.Namespace, creds.Name, creds.PasswordKey)
+	if err != nil {
+		return nil, err
+	}
+
+	apiClient := newN8nAPIClient(baseURL)
+	settings, err := apiClient.settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Data.UserManagement.ShowSetupOnFirstLoad {
+		if err := apiClient.setupOwner(ctx, email, password); err != nil {
+			return nil, fmt.Errorf("failed to set up the n8n owner account: %w", err)
+		}
+		r.Recorder.Event(n8n, "Normal", "OwnerCreated",
+			fmt.Sprintf("Set up the n8n owner account %s from Secret %s", email, creds.Name))
+		return apiClient, nil
+	}
+	if err := apiClient.login(ctx, email, password); err != nil {
+		return nil, fmt.Errorf("failed to log in to n8n: %w", err)
+	}
+	return apiClient, nil
+}
+
+// appliedConfigHash fingerprints settings applied through the n8n API. The Secrets and ConfigMaps they
+// are read from contribute their resource versions, so edits are detected without the values ending
+// up in the status.
+func appliedConfigHash(config interface{}, objects []client.Object) string {
+	hash := sha256.New()
+	_ = json.NewEncoder(hash).Encode(config)
+	for _, obj := range objects {
+		fmt.Fprintf(hash, "%T/%s@%s\n", obj, obj.GetName(), obj.GetResourceVersion())
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
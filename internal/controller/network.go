@@ -8,98 +8,176 @@ import (
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
-func (r *N8nReconciler) ingressForN8n(n8n *n8nv1alpha1.N8n) *networkingv1.Ingress {
+func (r *N8nReconciler) ingressForN8n(n8n *n8nv1alpha1.N8n, endpoint n8nEndpoint) *networkingv1.Ingress {
+	config := n8n.Spec.Ingress
 	pathType := networkingv1.PathTypePrefix
+	if config.PathType != "" {
+		pathType = networkingv1.PathType(config.PathType)
+	}
+	ingressClassName := config.IngressClassName
+	if endpoint.ingressClassName != "" {
+		ingressClassName = endpoint.ingressClassName
+	}
+
+	// The additional hosts and the custom path apply to the editor, which is the first endpoint
+	hosts := []string{endpoint.host}
+	endpointPaths := endpoint.paths
+	if endpoint.name == n8n.Name {
+		hosts = append(hosts, config.Hosts...)
+		if config.Path != "" {
+			endpointPaths = []string{config.Path}
+		}
+	}
+
+	var paths []networkingv1.HTTPIngressPath
+	for _, path := range endpointPaths {
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     path,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: n8n.Name,
+					Port: networkingv1.ServiceBackendPort{
+						Number: servicePortForN8n(n8n),
+					},
+				},
+			},
+		})
+	}
+
+	var rules []networkingv1.IngressRule
+	for _, host := range hosts {
+		rules = append(rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: paths,
+				},
+			},
+		})
+	}
+
+	annotations := map[string]string{}
+	mergeStringMap(&annotations, config.Annotations)
+	mergeStringMap(&annotations, certManagerAnnotations(n8n))
+
 	ing := &networkingv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      n8n.Name,
-			Namespace: n8n.Namespace,
+			Name:        endpoint.name,
+			Namespace:   n8n.Namespace,
+			Labels:      config.Labels,
+			Annotations: annotations,
 		},
 		Spec: networkingv1.IngressSpec{
-			IngressClassName: &n8n.Spec.Ingress.IngressClassName,
-			Rules: []networkingv1.IngressRule{
-				{
-					Host: n8n.Spec.Hostname.Url,
-					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: []networkingv1.HTTPIngressPath{
-								{
-									Path:     "/",
-									PathType: &pathType,
-									Backend: networkingv1.IngressBackend{
-										Service: &networkingv1.IngressServiceBackend{
-											Name: n8n.Name,
-											Port: networkingv1.ServiceBackendPort{
-												Number: 80,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
+			IngressClassName: &ingressClassName,
+			Rules:            rules,
 		},
 	}
 
-	if len(n8n.Spec.Ingress.TLS) > 0 {
-		ing.Spec.TLS = make([]networkingv1.IngressTLS, len(n8n.Spec.Ingress.TLS))
-		for i, tls := range n8n.Spec.Ingress.TLS {
-			ing.Spec.TLS[i] = networkingv1.IngressTLS{
-				Hosts:      tls.Hosts,
-				SecretName: tls.SecretName,
-			}
+	for _, tls := range config.TLS {
+		if !tlsCoversAnyHost(tls, hosts) {
+			continue
 		}
+		ing.Spec.TLS = append(ing.Spec.TLS, networkingv1.IngressTLS{
+			Hosts:      tls.Hosts,
+			SecretName: tls.SecretName,
+		})
 	}
 
 	ctrl.SetControllerReference(n8n, ing, r.Scheme)
 	return ing
 }
 
-func (r *N8nReconciler) httpRouteForN8n(n8n *n8nv1alpha1.N8n) *gatewayv1.HTTPRoute {
-	path := "/"
+// tlsCoversAnyHost reports whether a TLS entry applies to any of the hosts
+func tlsCoversAnyHost(tls n8nv1alpha1.IngressTLS, hosts []string) bool {
+	for _, host := range hosts {
+		if tlsCoversHost(tls, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsCoversHost reports whether a TLS entry applies to the host, entries without hosts apply to all
+func tlsCoversHost(tls n8nv1alpha1.IngressTLS, host string) bool {
+	if len(tls.Hosts) == 0 {
+		return true
+	}
+	for _, h := range tls.Hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *N8nReconciler) httpRouteForN8n(n8n *n8nv1alpha1.N8n, endpoint n8nEndpoint) *gatewayv1.HTTPRoute {
+	config := n8n.Spec.HTTPRoute
+	serviceGroup := gatewayv1.Group("")
 	serviceKind := gatewayv1.Kind("Service")
-	portNumber := gatewayv1.PortNumber(80)
+	portNumber := gatewayv1.PortNumber(servicePortForN8n(n8n))
+	weight := int32(1)
 	var pathType gatewayv1.PathMatchType = "PathPrefix"
+
+	var parentRefs []gatewayv1.ParentReference
+	for _, ref := range gatewayRefsForEndpoint(n8n, endpoint) {
+		parentRefs = append(parentRefs, parentRefForGateway(ref))
+	}
+
+	var matches []gatewayv1.HTTPRouteMatch
+	for _, path := range endpoint.paths {
+		matches = append(matches, gatewayv1.HTTPRouteMatch{
+			Path: &gatewayv1.HTTPPathMatch{
+				Type:  &pathType,
+				Value: &path,
+			},
+		})
+	}
+
+	var filters []gatewayv1.HTTPRouteFilter
+	if config.RequestHeaderModifier != nil {
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:                  gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: config.RequestHeaderModifier.DeepCopy(),
+		})
+	}
+	if config.ResponseHeaderModifier != nil {
+		filters = append(filters, gatewayv1.HTTPRouteFilter{
+			Type:                   gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+			ResponseHeaderModifier: config.ResponseHeaderModifier.DeepCopy(),
+		})
+	}
+
 	route := &gatewayv1.HTTPRoute{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      n8n.Name,
+			Name:      endpoint.name,
 			Namespace: n8n.Namespace,
 		},
 		Spec: gatewayv1.HTTPRouteSpec{
 			CommonRouteSpec: gatewayv1.CommonRouteSpec{
-				ParentRefs: []gatewayv1.ParentReference{
-					{
-						Name:      gatewayv1.ObjectName(n8n.Spec.HTTPRoute.GatewayRef.Name),
-						Namespace: (*gatewayv1.Namespace)(&n8n.Spec.HTTPRoute.GatewayRef.Namespace),
-					},
-				},
+				ParentRefs: parentRefs,
 			},
 			Hostnames: []gatewayv1.Hostname{
-				gatewayv1.Hostname(n8n.Spec.Hostname.Url),
+				gatewayv1.Hostname(endpoint.host),
 			},
 			Rules: []gatewayv1.HTTPRouteRule{
 				{
-					Matches: []gatewayv1.HTTPRouteMatch{
-						{
-							Path: &gatewayv1.HTTPPathMatch{
-								Type:  &pathType,
-								Value: &path,
-							},
-						},
-					},
+					Matches: matches,
+					Filters: filters,
 					BackendRefs: []gatewayv1.HTTPBackendRef{
 						{
 							BackendRef: gatewayv1.BackendRef{
 								BackendObjectReference: gatewayv1.BackendObjectReference{
-									Name: gatewayv1.ObjectName(n8n.Name),
-									Port: &portNumber,
-									Kind: &serviceKind,
+									Group: &serviceGroup,
+									Kind:  &serviceKind,
+									Name:  gatewayv1.ObjectName(n8n.Name),
+									Port:  &portNumber,
 								},
+								Weight: &weight,
 							},
 						},
 					},
+					Timeouts: config.Timeouts.DeepCopy(),
 				},
 			},
 		},
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+func networkPolicyEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.NetworkPolicy != nil && n8n.Spec.NetworkPolicy.Enable
+}
+
+func namespacePeer(namespace string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{namespaceNameLabel: namespace},
+		},
+	}
+}
+
+func networkPolicyPort(protocol corev1.Protocol, port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	return networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port}
+}
+
+// networkPolicySelector selects the main and the queue mode worker pods of the instance
+func networkPolicySelector(n8n *n8nv1alpha1.N8n) metav1.LabelSelector {
+	main, workers := instanceLabelsForN8n(n8n), workerLabels(n8n)
+	return metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			instanceLabel:                  n8n.Name,
+			"app.kubernetes.io/managed-by": main["app.kubernetes.io/managed-by"],
+		},
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      "app.kubernetes.io/name",
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   []string{main["app.kubernetes.io/name"], workers["app.kubernetes.io/name"]},
+		}},
+	}
+}
+
+// networkPolicyForN8n returns the NetworkPolicy only letting the ingress controller, Prometheus and the
+// operator reach n8n, and with DefaultDeny only letting n8n reach its dependencies
+func (r *N8nReconciler) networkPolicyForN8n(ctx context.Context, n8n *n8nv1alpha1.N8n) (*networkingv1.NetworkPolicy, error) {
+	config := n8n.Spec.NetworkPolicy
+
+	var sources []networkingv1.NetworkPolicyPeer
+	for _, ns := range config.IngressNamespaces {
+		sources = append(sources, namespacePeer(ns))
+	}
+	if n8n.Spec.HTTPRoute != nil && n8n.Spec.HTTPRoute.Enable {
+		seen := map[string]bool{}
+		for _, endpoint := range endpointsForN8n(n8n) {
+			for _, ref := range gatewayRefsForEndpoint(n8n, endpoint) {
+				if !seen[ref.Namespace] {
+					seen[ref.Namespace] = true
+					sources = append(sources, namespacePeer(ref.Namespace))
+				}
+			}
+		}
+	}
+	if metricsEnabled(n8n) {
+		for _, ns := range config.MonitoringNamespaces {
+			sources = append(sources, namespacePeer(ns))
+		}
+	}
+	// The operator reads the license state and applies the identity provider settings through the n8n API
+	sources = append(sources, networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{},
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"control-plane": "controller-manager"},
+		},
+	})
+
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      n8n.Name,
+			Namespace: n8n.Namespace,
+			Labels:    labelsForN8n(),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: networkPolicySelector(n8n),
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From:  sources,
+				Ports: []networkingv1.NetworkPolicyPort{networkPolicyPort(corev1.ProtocolTCP, intstr.FromString("http"))},
+			}},
+		},
+	}
+
+	if config.DefaultDeny {
+		egress, err := r.egressRulesForN8n(ctx, n8n)
+		if err != nil {
+			return nil, err
+		}
+		np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		np.Spec.Egress = egress
+	}
+
+	if err := ctrl.SetControllerReference(n8n, np, r.Scheme); err != nil {
+		return nil, err
+	}
+	return np, nil
+}
+
+// egressRulesForN8n returns the destinations n8n may connect to under DefaultDeny
+func (r *N8nReconciler) egressRulesForN8n(ctx context.Context, n8n *n8nv1alpha1.N8n) ([]networkingv1.NetworkPolicyEgressRule, error) {
+	rules := []networkingv1.NetworkPolicyEgressRule{{
+		// DNS servers differ between clusters, allow the port wherever they run
+		Ports: []networkingv1.NetworkPolicyPort{
+			networkPolicyPort(corev1.ProtocolUDP, intstr.FromInt32(53)),
+			networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(53)),
+		},
+	}}
+
+	pg := n8n.Spec.Database.Postgres
+	rule, err := r.egressRuleForHost(ctx, n8n, pg.Host, int32(pg.Port))
+	if err != nil {
+		return nil, err
+	}
+	rules = append(rules, rule)
+
+	// Queue mode connects n8n to Redis
+	if queueModeEnabled(n8n) {
+		host, port := redisHostPort(n8n)
+		rule, err := r.egressRuleForHost(ctx, n8n, host, port)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if cidrs := n8n.Spec.NetworkPolicy.EgressCIDRs; len(cidrs) > 0 {
+		var peers []networkingv1.NetworkPolicyPeer
+		for _, cidr := range cidrs {
+			peers = append(peers, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+		}
+		rules = append(rules, networkingv1.NetworkPolicyEgressRule{To: peers})
+	}
+	return rules, nil
+}
+
+// egressRuleForHost allows connections to a host. IP addresses and in-cluster Services are matched
+// precisely, other hostnames can't be expressed in a NetworkPolicy and only restrict the port.
+func (r *N8nReconciler) egressRuleForHost(ctx context.Context, n8n *n8nv1alpha1.N8n, host string, port int32) (networkingv1.NetworkPolicyEgressRule, error) {
+	rule := networkingv1.NetworkPolicyEgressRule{
+		Ports: []networkingv1.NetworkPolicyPort{networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(port))},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		rule.To = []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{
+			CIDR: (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String(),
+		}}}
+		return rule, nil
+	}
+
+	name, namespace, ok := serviceOfHost(host, n8n.Namespace)
+	if !ok {
+		return rule, nil
+	}
+	svc := &corev1.Service{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, svc); err != nil {
+		if apierrors.IsNotFound(err) {
+			return rule, nil
+		}
+		return rule, err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return rule, nil
+	}
+
+	// Policies apply to the pods behind the Service, so match them on the target port
+	for _, p := range svc.Spec.Ports {
+		if p.Port != port {
+			continue
+		}
+		target := p.TargetPort
+		if target.Type == intstr.Int && target.IntVal == 0 {
+			target = intstr.FromInt32(p.Port)
+		}
+		rule.Ports = []networkingv1.NetworkPolicyPort{networkPolicyPort(corev1.ProtocolTCP, target)}
+	}
+	rule.To = []networkingv1.NetworkPolicyPeer{{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: namespace}},
+		PodSelector:       &metav1.LabelSelector{MatchLabels: svc.Spec.Selector},
+	}}
+	return rule, nil
+}
+
+// serviceOfHost returns the Service a cluster-local hostname such as "postgres", "postgres.db" or
+// "postgres.db.svc.cluster.local" resolves to
+func serviceOfHost(host, namespace string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSuffix(host, "."), ".")
+	switch {
+	case len(parts) == 1:
+		return parts[0], namespace, true
+	case len(parts) == 2:
+		return parts[0], parts[1], true
+	case len(parts) >= 3 && parts[2] == "svc":
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+// createOrUpdateNetworkPolicy reconciles the NetworkPolicy, removing it when disabled
+func (r *N8nReconciler) createOrUpdateNetworkPolicy(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	if !networkPolicyEnabled(n8n) {
+		return r.deleteIfExists(ctx, n8n, &networkingv1.NetworkPolicy{})
+	}
+
+	np, err := r.networkPolicyForN8n(ctx, n8n)
+	if err != nil {
+		return err
+	}
+	return r.createOrUpdateSpec(ctx, np, &networkingv1.NetworkPolicy{}, func(existing client.Object) bool {
+		current := existing.(*networkingv1.NetworkPolicy)
+		if reflect.DeepEqual(current.Spec, np.Spec) {
+			return false
+		}
+		current.Spec = np.Spec
+		return true
+	})
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultRedisPort = 6379
+
+// queueModeEnabled reports whether n8n runs in queue mode, executing workflows on separate worker pods.
+// Unlike autoscaling it stays on while suspended, so the main instance keeps its configuration.
+func queueModeEnabled(n8n *n8nv1alpha1.N8n) bool {
+	as := n8n.Spec.Autoscaling
+	return as != nil && as.Enable && as.Queue != nil && as.Queue.Enable
+}
+
+func workerName(n8n *n8nv1alpha1.N8n) string {
+	return n8n.Name + "-worker"
+}
+
+// workerLabels returns the labels of the worker pods. They differ from the main pods in the name, so
+// the selector of the main Deployment doesn't match them.
+func workerLabels(n8n *n8nv1alpha1.N8n) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       "n8n-worker",
+		"app.kubernetes.io/instance":   n8n.Name,
+		"app.kubernetes.io/managed-by": "N8nController",
+	}
+}
+
+// redisHostPort splits the address of the Redis server holding the queue
+func redisHostPort(n8n *n8nv1alpha1.N8n) (string, int32) {
+	address := n8n.Spec.Autoscaling.Queue.RedisAddress
+	host, port := address, int32(defaultRedisPort)
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		host = h
+		if n, err := strconv.ParseInt(p, 10, 32); err == nil {
+			port = int32(n)
+		}
+	}
+	return host, port
+}
+
+// getQueueEnvVars returns the environment variables connecting the main instance and the workers to the queue
+func getQueueEnvVars(n8n *n8nv1alpha1.N8n) []corev1.EnvVar {
+	if !queueModeEnabled(n8n) {
+		return nil
+	}
+
+	queue := n8n.Spec.Autoscaling.Queue
+	host, port := redisHostPort(n8n)
+	envVars := []corev1.EnvVar{
+		{Name: "EXECUTIONS_MODE", Value: "queue"},
+		{Name: "QUEUE_BULL_REDIS_HOST", Value: host},
+		{Name: "QUEUE_BULL_REDIS_PORT", Value: fmt.Sprintf("%d", port)},
+		{Name: "OFFLOAD_MANUAL_EXECUTIONS_TO_WORKERS", Value: "true"},
+	}
+	if queue.PasswordSecret != nil {
+		envVars = append(envVars, secretEnvVar("QUEUE_BULL_REDIS_PASSWORD", queue.PasswordSecret.Name, queue.PasswordSecret.Key))
+	}
+	return envVars
+}
+
+// workerDeploymentForN8n derives the worker Deployment from the main Deployment, so the workers run the
+// image the upgrade workflow rolled out together with the same environment
+func (r *N8nReconciler) workerDeploymentForN8n(n8n *n8nv1alpha1.N8n, main *appsv1.Deployment, sharedStorage bool) (*appsv1.Deployment, error) {
+	ls := workerLabels(n8n)
+	template := main.Spec.Template.DeepCopy()
+	template.Labels = ls
+	template.Annotations = nil
+
+	container := n8nContainer(&appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: *template}})
+	container.Command = []string{"tini", "--", "/docker-entrypoint.sh", "worker"}
+	container.Ports = nil
+
+	// Without shared storage only the main pod can mount the data volume, workers read the
+	// encryption key from the environment instead
+	if !sharedStorage {
+		for i := range template.Spec.Volumes {
+			if template.Spec.Volumes[i].Name == "n8n-data" {
+				template.Spec.Volumes[i].VolumeSource = corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+			}
+		}
+		template.Spec.InitContainers = nil
+	}
+
+	// The autoscaler owns the number of workers, without it they are stopped
+	var replicas *int32
+	if !autoscalingEnabled(n8n) {
+		replicas = &[]int32{0}[0]
+	}
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workerName(n8n),
+			Namespace: n8n.Namespace,
+			Labels:    ls,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: ls,
+			},
+			Template: *template,
+		},
+	}
+	if err := ctrl.SetControllerReference(n8n, dep, r.Scheme); err != nil {
+		return nil, err
+	}
+	return dep, nil
+}
+
+// createOrUpdateWorkers runs the queue mode workers next to the main Deployment and removes them otherwise
+func (r *N8nReconciler) createOrUpdateWorkers(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	if !queueModeEnabled(n8n) {
+		return r.deleteNamedIfExists(ctx, n8n, &appsv1.Deployment{}, workerName(n8n))
+	}
+
+	main := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: n8n.Name, Namespace: n8n.Namespace}, main); err != nil {
+		return err
+	}
+	shared, err := r.sharedStorage(ctx, n8n)
+	if err != nil {
+		return err
+	}
+	if !readsEncryptionKey(main) && !shared {
+		r.Recorder.Event(n8n, "Warning", "EncryptionKeyNotShared",
+			"Queue mode workers need the encryption key n8n keeps in its data volume, reference it in encryptionKeySecret")
+		return r.deleteNamedIfExists(ctx, n8n, &appsv1.Deployment{}, workerName(n8n))
+	}
+
+	dep, err := r.workerDeploymentForN8n(n8n, main, shared)
+	if err != nil {
+		return err
+	}
+	return r.createOrUpdateSpec(ctx, dep, &appsv1.Deployment{}, func(existing client.Object) bool {
+		current := existing.(*appsv1.Deployment)
+		changed := false
+		// The API server defaults fields of the pod template, only compare the ones set here
+		if !equality.Semantic.DeepDerivative(dep.Spec.Template, current.Spec.Template) {
+			current.Spec.Template = dep.Spec.Template
+			changed = true
+		}
+		replicas := dep.Spec.Replicas
+		// An autoscaler doesn't scale up from zero, hand it the workers at their minimum
+		if replicas == nil && current.Spec.Replicas != nil && *current.Spec.Replicas == 0 {
+			minReplicas := max(n8n.Spec.Autoscaling.MinReplicas, 1)
+			replicas = &minReplicas
+		}
+		if replicas != nil && (current.Spec.Replicas == nil || *current.Spec.Replicas != *replicas) {
+			current.Spec.Replicas = replicas
+			changed = true
+		}
+		return changed
+	})
+}
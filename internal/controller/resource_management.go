@@ -3,17 +3,20 @@ package controller
 import (
 	"context"
 	"fmt"
+	"reflect"
 
 	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
-	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
@@ -29,13 +32,26 @@ func (r *N8nReconciler) reconcileResource(ctx context.Context, n8n *n8nv1alpha1.
 	return err
 }
 
+// createIfNotExists creates desired unless an object of the same name exists
+func (r *N8nReconciler) createIfNotExists(ctx context.Context, desired, existing client.Object) error {
+	err := r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, existing)
+	if err != nil && apierrors.IsNotFound(err) {
+		if err := r.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create resource: %w", err)
+		}
+		return nil
+	}
+	return err
+}
+
 // updateStatus handles updating the status conditions of the N8n resource
 func (r *N8nReconciler) updateStatus(ctx context.Context, n8n *n8nv1alpha1.N8n, conditionType string, status metav1.ConditionStatus, reason, message string) error {
 	meta.SetStatusCondition(&n8n.Status.Conditions, metav1.Condition{
-		Type:    conditionType,
-		Status:  status,
-		Reason:  reason,
-		Message: message,
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: n8n.Generation,
+		Reason:             reason,
+		Message:            message,
 	})
 	return r.Status().Update(ctx, n8n)
 }
@@ -52,65 +68,259 @@ func (r *N8nReconciler) handleResourceError(ctx context.Context, n8n *n8nv1alpha
 }
 
 // createOrUpdateDeployment handles the deployment reconciliation
-func (r *N8nReconciler) createOrUpdateDeployment(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
-	return r.reconcileResource(ctx, n8n, &appsv1.Deployment{}, func() error {
-		dep, err := r.deploymentForN8n(n8n)
+func (r *N8nReconciler) createOrUpdateDeployment(ctx context.Context, n8n *n8nv1alpha1.N8n, encryptionKeyFromSecret bool) error {
+	urls, err := r.urlsForN8n(ctx, n8n)
+	if err != nil {
+		return err
+	}
+	dep, err := r.deploymentForN8n(n8n, urls, encryptionKeyFromSecret)
+	if err != nil {
+		return r.handleResourceError(ctx, n8n, err, "Deployment")
+	}
+	if deleted, err := r.deleteDeploymentWithSharedSelector(ctx, n8n); err != nil || deleted {
 		if err != nil {
-			return r.handleResourceError(ctx, n8n, err, "Deployment")
+			return err
 		}
+		// The cache may still hold the deleted Deployment, create the replacement right away
 		return r.Create(ctx, dep)
+	}
+
+	// The image and the replicas are owned by the upgrade and suspension workflows, keep the rest of the pod
+	// template the operator configures in sync so configuration changes reach n8n
+	return r.createOrUpdateSpec(ctx, dep, &appsv1.Deployment{}, func(existing client.Object) bool {
+		pod := &existing.(*appsv1.Deployment).Spec.Template.Spec
+		current := n8nContainer(existing.(*appsv1.Deployment))
+		desired := n8nContainer(dep)
+		if current == nil {
+			return false
+		}
+		changed := syncServingCert(pod, current, dep.Spec.Template.Spec.Volumes, desired.VolumeMounts)
+		changed = syncDataVolume(pod, dep.Spec.Template.Spec.Volumes) || changed
+		// The API server defaults fields of the init containers, only compare the ones set here
+		if initContainers := dep.Spec.Template.Spec.InitContainers; len(initContainers) != len(pod.InitContainers) ||
+			!equality.Semantic.DeepDerivative(initContainers, pod.InitContainers) {
+			pod.InitContainers = initContainers
+			changed = true
+		}
+		// Older Deployments lack the instance label the PodMonitor selects
+		template := &existing.(*appsv1.Deployment).Spec.Template
+		changed = mergeStringMap(&template.Labels, map[string]string{instanceLabel: n8n.Name}) || changed
+		if !reflect.DeepEqual(current.Env, desired.Env) {
+			current.Env = desired.Env
+			changed = true
+		}
+		if !equality.Semantic.DeepEqual(pod.SecurityContext, dep.Spec.Template.Spec.SecurityContext) {
+			pod.SecurityContext = dep.Spec.Template.Spec.SecurityContext
+			changed = true
+		}
+		if !equality.Semantic.DeepEqual(current.SecurityContext, desired.SecurityContext) {
+			current.SecurityContext = desired.SecurityContext
+			changed = true
+		}
+		// A read-only root filesystem needs the writable volumes to be in place
+		for _, name := range n8nWritableVolumes {
+			changed = syncVolume(pod, current, name, dep.Spec.Template.Spec.Volumes, desired.VolumeMounts) || changed
+		}
+		return changed
 	})
 }
 
+// deleteDeploymentWithSharedSelector deletes a Deployment created before its selector carried the instance label,
+// since that selector matches the pods of every instance in the namespace, and reports whether it did. Selectors
+// are immutable, so the Deployment is recreated with the instance label afterwards, restarting n8n once.
+func (r *N8nReconciler) deleteDeploymentWithSharedSelector(ctx context.Context, n8n *n8nv1alpha1.N8n) (bool, error) {
+	existing := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: n8n.Name, Namespace: n8n.Namespace}, existing)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if existing.Spec.Selector == nil || existing.Spec.Selector.MatchLabels[instanceLabel] == n8n.Name {
+		return false, nil
+	}
+
+	log.FromContext(ctx).Info("Recreating the Deployment with a selector limited to the instance", "Deployment.Name", existing.Name)
+	r.Recorder.Event(n8n, "Normal", "DeploymentRecreated",
+		fmt.Sprintf("Recreating Deployment %s to limit its selector to the pods of the instance", existing.Name))
+	if err := r.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // createOrUpdateService handles the service reconciliation
 func (r *N8nReconciler) createOrUpdateService(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
-	return r.reconcileResource(ctx, n8n, &corev1.Service{}, func() error {
-		svc := r.serviceForN8n(n8n)
-		return r.Create(ctx, svc)
+	svc := r.serviceForN8n(n8n)
+	recordManagedMetadata(svc)
+	return r.createOrUpdateSpec(ctx, svc, &corev1.Service{}, func(existing client.Object) bool {
+		current := existing.(*corev1.Service)
+		changed := syncMetadata(current, svc)
+		// Keep the node ports allocated by the API server
+		ports := svc.Spec.Ports
+		if svc.Spec.Type != corev1.ServiceTypeClusterIP && len(current.Spec.Ports) == 1 {
+			ports[0].NodePort = current.Spec.Ports[0].NodePort
+		}
+		if current.Spec.Type != svc.Spec.Type {
+			current.Spec.Type = svc.Spec.Type
+			changed = true
+		}
+		if !reflect.DeepEqual(current.Spec.Ports, ports) {
+			current.Spec.Ports = ports
+			changed = true
+		}
+		if !reflect.DeepEqual(current.Spec.Selector, svc.Spec.Selector) {
+			current.Spec.Selector = svc.Spec.Selector
+			changed = true
+		}
+		if !reflect.DeepEqual(current.Spec.LoadBalancerSourceRanges, svc.Spec.LoadBalancerSourceRanges) {
+			current.Spec.LoadBalancerSourceRanges = svc.Spec.LoadBalancerSourceRanges
+			changed = true
+		}
+		if current.Spec.ExternalTrafficPolicy != svc.Spec.ExternalTrafficPolicy {
+			current.Spec.ExternalTrafficPolicy = svc.Spec.ExternalTrafficPolicy
+			changed = true
+		}
+		return changed
 	})
 }
 
+// endpointObjectNames returns the names of the Ingresses or HTTPRoutes the operator may have created
+func endpointObjectNames(n8n *n8nv1alpha1.N8n) []string {
+	return []string{n8n.Name, n8n.Name + webhookEndpointSuffix}
+}
+
+// deleteStaleEndpointObjects deletes the Ingresses or HTTPRoutes of endpoints that are no longer exposed
+func (r *N8nReconciler) deleteStaleEndpointObjects(ctx context.Context, n8n *n8nv1alpha1.N8n, exposed bool,
+	newObject func() client.Object) error {
+	desired := map[string]bool{}
+	if exposed {
+		for _, endpoint := range endpointsForN8n(n8n) {
+			desired[endpoint.name] = true
+		}
+	}
+	for _, name := range endpointObjectNames(n8n) {
+		if desired[name] {
+			continue
+		}
+		if err := r.deleteNamedIfExists(ctx, n8n, newObject(), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // createOrUpdateIngress handles the ingress reconciliation
 func (r *N8nReconciler) createOrUpdateIngress(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
-	if n8n.Spec.Ingress == nil || !n8n.Spec.Ingress.Enable {
+	enabled := n8n.Spec.Ingress != nil && n8n.Spec.Ingress.Enable
+	if err := r.deleteStaleEndpointObjects(ctx, n8n, enabled, func() client.Object { return &networkingv1.Ingress{} }); err != nil {
+		return err
+	}
+	if !enabled {
 		return nil
 	}
-	return r.reconcileResource(ctx, n8n, &networkingv1.Ingress{}, func() error {
-		ing := r.ingressForN8n(n8n)
-		return r.Create(ctx, ing)
-	})
+	for _, endpoint := range endpointsForN8n(n8n) {
+		ing := r.ingressForN8n(n8n, endpoint)
+		recordManagedMetadata(ing)
+		if err := r.createOrUpdateSpec(ctx, ing, &networkingv1.Ingress{}, func(existing client.Object) bool {
+			current := existing.(*networkingv1.Ingress)
+			changed := syncMetadata(current, ing)
+			if !reflect.DeepEqual(current.Spec, ing.Spec) {
+				current.Spec = ing.Spec
+				changed = true
+			}
+			return changed
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // createOrUpdateHTTPRoute handles the HTTPRoute reconciliation
 func (r *N8nReconciler) createOrUpdateHTTPRoute(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
-	if n8n.Spec.HTTPRoute == nil || !n8n.Spec.HTTPRoute.Enable {
+	available, err := r.apiAvailable(httpRouteGVK)
+	if err != nil {
+		return err
+	}
+	if available {
+		if err := r.deleteStaleEndpointObjects(ctx, n8n, httpRouteEnabled(n8n),
+			func() client.Object { return &gatewayv1.HTTPRoute{} }); err != nil {
+			return err
+		}
+	}
+	if !httpRouteEnabled(n8n) {
 		return nil
 	}
-	return r.reconcileResource(ctx, n8n, &gatewayv1.HTTPRoute{}, func() error {
-		route := r.httpRouteForN8n(n8n)
-		return r.Create(ctx, route)
-	})
+	for _, endpoint := range endpointsForN8n(n8n) {
+		route := r.httpRouteForN8n(n8n, endpoint)
+		if err := r.createOrUpdateSpec(ctx, route, &gatewayv1.HTTPRoute{}, func(existing client.Object) bool {
+			current := existing.(*gatewayv1.HTTPRoute)
+			if reflect.DeepEqual(current.Spec, route.Spec) {
+				return false
+			}
+			current.Spec = route.Spec
+			return true
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secretValue reads a single key of a Secret
+func (r *N8nReconciler) secretValue(ctx context.Context, namespace, name, key string) (string, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+		return "", fmt.Errorf("failed to get Secret %s: %w", name, err)
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s does not contain key %s", name, key)
+	}
+	return string(value), nil
 }
 
-func (r *N8nReconciler) createOrUpdateServiceMonitor(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
-	sm := &monitoringv1.ServiceMonitor{}
-	err := r.Get(ctx, types.NamespacedName{Name: n8n.Name, Namespace: n8n.Namespace}, sm)
+// configMapValue reads a single key of a ConfigMap
+func (r *N8nReconciler) configMapValue(ctx context.Context, namespace, name, key string) (string, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, cm); err != nil {
+		return "", fmt.Errorf("failed to get ConfigMap %s: %w", name, err)
+	}
+	value, ok := cm.Data[key]
+	if !ok {
+		return "", fmt.Errorf("configmap %s does not contain key %s", name, key)
+	}
+	return value, nil
+}
 
-	// If metrics are disabled, delete the ServiceMonitor if it exists
-	if n8n.Spec.Metrics == nil || !n8n.Spec.Metrics.Enable {
-		if err == nil {
-			return r.Delete(ctx, sm)
-		}
-		if apierrors.IsNotFound(err) {
-			return nil
-		}
+// deleteIfExists deletes the child object named after the N8n resource if it exists
+func (r *N8nReconciler) deleteIfExists(ctx context.Context, n8n *n8nv1alpha1.N8n, obj client.Object) error {
+	return r.deleteNamedIfExists(ctx, n8n, obj, n8n.Name)
+}
+
+// deleteNamedIfExists deletes a child object that is no longer configured and records an event for it.
+// Objects of the same name the N8n resource doesn't control are left alone.
+func (r *N8nReconciler) deleteNamedIfExists(ctx context.Context, n8n *n8nv1alpha1.N8n, obj client.Object, name string) error {
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: n8n.Namespace}, obj)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
 		return err
 	}
+	if !metav1.IsControlledBy(obj, n8n) {
+		return nil
+	}
+	if err := r.Delete(ctx, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
 
-	// Create ServiceMonitor if it doesn't exist
-	if apierrors.IsNotFound(err) {
-		sm = r.serviceMonitorForN8n(n8n)
-		return r.Create(ctx, sm)
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if gvk, err := apiutil.GVKForObject(obj, r.Scheme); err == nil {
+		kind = gvk.Kind
 	}
-	return err
+	r.Recorder.Eventf(n8n, "Normal", "Deleted", "Deleted %s %s as it is no longer configured", kind, name)
+	return nil
 }
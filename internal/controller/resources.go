@@ -36,8 +36,27 @@ func getN8nVersion() string {
 	return defaultN8nVersion
 }
 
+const n8nImageRepository = "ghcr.io/n8n-io/n8n"
+
+const instanceLabel = "app.kubernetes.io/instance"
+
+const defaultServicePort = 80
+
 var n8nVersion = getN8nVersion()
-var n8nDockerImage = "ghcr.io/n8n-io/n8n:" + n8nVersion
+var n8nDockerImage = n8nImage(n8nVersion)
+
+// n8nImage returns the n8n container image of the given version
+func n8nImage(version string) string {
+	return n8nImageRepository + ":" + version
+}
+
+// versionOfImage returns the tag of an n8n container image
+func versionOfImage(image string) string {
+	if i := strings.LastIndex(image, ":"); i >= 0 {
+		return image[i+1:]
+	}
+	return ""
+}
 
 func labelsForN8n() map[string]string {
 	var imageTag string
@@ -50,17 +69,44 @@ func labelsForN8n() map[string]string {
 	}
 }
 
+// selectorLabelsForN8n returns the labels shared by the n8n pods of every instance. Unlike labelsForN8n
+// they don't carry the version, so selectors keep matching across n8n and operator upgrades. Selectors
+// add the instance label, see instanceLabelsForN8n.
+func selectorLabelsForN8n() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       "n8n-operator",
+		"app.kubernetes.io/managed-by": "N8nController",
+	}
+}
+
+// instanceLabelsForN8n returns the labels telling the Service and pods of the N8n resource apart
+// from those of other instances in the namespace
+func instanceLabelsForN8n(n8n *n8nv1alpha1.N8n) map[string]string {
+	labels := selectorLabelsForN8n()
+	labels[instanceLabel] = n8n.Name
+	return labels
+}
+
+// servicePortForN8n returns the port the n8n Service exposes n8n on
+func servicePortForN8n(n8n *n8nv1alpha1.N8n) int32 {
+	if n8n.Spec.Service == nil || n8n.Spec.Service.Port == 0 {
+		return defaultServicePort
+	}
+	return n8n.Spec.Service.Port
+}
+
 func (r *N8nReconciler) serviceForN8n(n8n *n8nv1alpha1.N8n) *corev1.Service {
-	ls := labelsForN8n()
+	ls := serviceSelectorForN8n(n8n)
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      n8n.Name,
 			Namespace: n8n.Namespace,
+			Labels:    instanceLabelsForN8n(n8n),
 		},
 		Spec: corev1.ServiceSpec{
 			Type: corev1.ServiceTypeClusterIP,
 			Ports: []corev1.ServicePort{{
-				Port:       80,
+				Port:       servicePortForN8n(n8n),
 				TargetPort: intstr.FromString("http"),
 				Protocol:   corev1.ProtocolTCP,
 				Name:       "http",
@@ -68,6 +114,23 @@ func (r *N8nReconciler) serviceForN8n(n8n *n8nv1alpha1.N8n) *corev1.Service {
 			Selector: ls,
 		},
 	}
+	if config := n8n.Spec.Service; config != nil {
+		if config.Type != "" {
+			svc.Spec.Type = config.Type
+		}
+		mergeStringMap(&svc.Annotations, config.Annotations)
+		svc.Spec.LoadBalancerSourceRanges = config.LoadBalancerSourceRanges
+	}
+	if serviceCAIssuesServingCert(n8n) {
+		mergeStringMap(&svc.Annotations, map[string]string{servingCertAnnotation: servingCertSecretName(n8n)})
+	}
+	// Spell out the policy the API server defaults to, so that the spec compares equal
+	if svc.Spec.Type != corev1.ServiceTypeClusterIP {
+		svc.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyCluster
+		if n8n.Spec.Service.ExternalTrafficPolicy != "" {
+			svc.Spec.ExternalTrafficPolicy = n8n.Spec.Service.ExternalTrafficPolicy
+		}
+	}
 	ctrl.SetControllerReference(n8n, svc, r.Scheme)
 	return svc
 }
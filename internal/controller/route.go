@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	typeRouteAdmittedN8n  = "RouteAdmitted"
+	routePollInterval     = 15 * time.Second
+	servingCertAnnotation = "service.beta.openshift.io/serving-cert-secret-name"
+	servingCertVolume     = "serving-cert"
+	servingCertPath       = "/etc/n8n/tls"
+)
+
+var routeGVK = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+func routeEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.Route != nil && n8n.Spec.Route.Enable
+}
+
+// routeTermination returns where the Route terminates TLS, empty for plain HTTP
+func routeTermination(n8n *n8nv1alpha1.N8n) n8nv1alpha1.RouteTermination {
+	if !routeEnabled(n8n) || n8n.Spec.Route.TLS == nil {
+		return ""
+	}
+	if n8n.Spec.Route.TLS.Termination == "" {
+		return n8nv1alpha1.RouteTerminationEdge
+	}
+	return n8n.Spec.Route.TLS.Termination
+}
+
+// servingTLS reports whether n8n serves TLS itself, for Routes not terminating it at the router
+func servingTLS(n8n *n8nv1alpha1.N8n) bool {
+	termination := routeTermination(n8n)
+	return termination == n8nv1alpha1.RouteTerminationReencrypt || termination == n8nv1alpha1.RouteTerminationPassthrough
+}
+
+// servingCertSecretName returns the Secret holding the certificate n8n serves, issued by the OpenShift
+// service CA unless the user provides one
+func servingCertSecretName(n8n *n8nv1alpha1.N8n) string {
+	if n8n.Spec.Route.TLS.ServingCertSecret != "" {
+		return n8n.Spec.Route.TLS.ServingCertSecret
+	}
+	return n8n.Name + "-serving-cert"
+}
+
+// serviceCAIssuesServingCert reports whether the Service must ask the OpenShift service CA for a certificate
+func serviceCAIssuesServingCert(n8n *n8nv1alpha1.N8n) bool {
+	return servingTLS(n8n) && n8n.Spec.Route.TLS.ServingCertSecret == ""
+}
+
+// servingCertVolumes returns the volume and mount of the certificate n8n serves, if any
+func servingCertVolumes(n8n *n8nv1alpha1.N8n) ([]corev1.Volume, []corev1.VolumeMount) {
+	if !servingTLS(n8n) {
+		return nil, nil
+	}
+	volume := corev1.Volume{
+		Name: servingCertVolume,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: servingCertSecretName(n8n)},
+		},
+	}
+	mount := corev1.VolumeMount{Name: servingCertVolume, MountPath: servingCertPath, ReadOnly: true}
+	return []corev1.Volume{volume}, []corev1.VolumeMount{mount}
+}
+
+// syncServingCert adds or removes the serving certificate volume of the pod to match the desired volumes
+func syncServingCert(pod *corev1.PodSpec, container *corev1.Container, volumes []corev1.Volume, mounts []corev1.VolumeMount) bool {
+	return syncVolume(pod, container, servingCertVolume, volumes, mounts)
+}
+
+// routeForN8n returns the Route exposing the n8n Service on the hostname
+func (r *N8nReconciler) routeForN8n(n8n *n8nv1alpha1.N8n) (*unstructured.Unstructured, error) {
+	config := n8n.Spec.Route
+	// Spell out the fields the API server defaults to, so that the spec compares equal
+	spec := map[string]interface{}{
+		"host": editorHostForN8n(n8n),
+		"to": map[string]interface{}{
+			"kind":   "Service",
+			"name":   n8n.Name,
+			"weight": int64(100),
+		},
+		"port": map[string]interface{}{
+			"targetPort": "http",
+		},
+		"wildcardPolicy": "None",
+	}
+	// The router can't see the path of encrypted requests, OpenShift rejects passthrough Routes with one
+	if routeTermination(n8n) != n8nv1alpha1.RouteTerminationPassthrough {
+		spec["path"] = pathForN8n(n8n)
+	}
+	if termination := routeTermination(n8n); termination != "" {
+		insecurePolicy := config.TLS.InsecureEdgeTerminationPolicy
+		if insecurePolicy == "" {
+			insecurePolicy = "Redirect"
+		}
+		spec["tls"] = map[string]interface{}{
+			"termination":                   string(termination),
+			"insecureEdgeTerminationPolicy": insecurePolicy,
+		}
+	}
+
+	route := newUnstructured(routeGVK)
+	route.SetName(n8n.Name)
+	route.SetNamespace(n8n.Namespace)
+	route.SetLabels(config.Labels)
+	route.SetAnnotations(config.Annotations)
+	route.Object["spec"] = spec
+	if err := ctrl.SetControllerReference(n8n, route, r.Scheme); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// reconcileRoute creates the OpenShift Route and reports whether the routers admitted it
+func (r *N8nReconciler) reconcileRoute(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	available, err := r.apiAvailable(routeGVK)
+	if err != nil {
+		return err
+	}
+
+	if !routeEnabled(n8n) {
+		if available {
+			if err := r.deleteIfExists(ctx, n8n, newUnstructured(routeGVK)); err != nil {
+				return err
+			}
+		}
+		if meta.FindStatusCondition(n8n.Status.Conditions, typeRouteAdmittedN8n) != nil {
+			meta.RemoveStatusCondition(&n8n.Status.Conditions, typeRouteAdmittedN8n)
+			return r.Status().Update(ctx, n8n)
+		}
+		return nil
+	}
+
+	if !available {
+		if !meta.IsStatusConditionFalse(n8n.Status.Conditions, typeRouteAdmittedN8n) {
+			r.Recorder.Event(n8n, "Warning", "RouteAPINotAvailable", "Routes require OpenShift")
+		}
+		return r.updateStatus(ctx, n8n, typeRouteAdmittedN8n, metav1.ConditionFalse, "RouteAPINotAvailable",
+			"Routes require OpenShift")
+	}
+
+	route, err := r.routeForN8n(n8n)
+	if err != nil {
+		return err
+	}
+	recordManagedMetadata(route)
+	if err := r.createOrUpdateSpec(ctx, route, newUnstructured(routeGVK), func(existing client.Object) bool {
+		current := existing.(*unstructured.Unstructured)
+		changed := syncMetadata(current, route)
+		if !reflect.DeepEqual(current.Object["spec"], route.Object["spec"]) {
+			current.Object["spec"] = route.Object["spec"]
+			changed = true
+		}
+		return changed
+	}); err != nil {
+		return err
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(route), route); err != nil {
+		return err
+	}
+
+	admitted, rejected := routeAdmission(route)
+	switch {
+	case admitted:
+		return r.updateStatus(ctx, n8n, typeRouteAdmittedN8n, metav1.ConditionTrue, "Admitted", "Route is admitted")
+	case len(rejected) > 0:
+		return r.updateStatus(ctx, n8n, typeRouteAdmittedN8n, metav1.ConditionFalse, "Rejected",
+			strings.Join(rejected, "; "))
+	}
+	return r.updateStatus(ctx, n8n, typeRouteAdmittedN8n, metav1.ConditionFalse, "Pending",
+		"Waiting for a router to admit the Route")
+}
+
+// routeAdmission reports whether any router admitted the Route, and why routers rejected it
+func routeAdmission(route *unstructured.Unstructured) (bool, []string) {
+	admitted := false
+	var rejected []string
+	ingresses, _, _ := unstructured.NestedSlice(route.Object, "status", "ingress")
+	for _, i := range ingresses {
+		ingress, ok := i.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditions, _, _ := unstructured.NestedSlice(ingress, "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["type"] != "Admitted" {
+				continue
+			}
+			switch condition["status"] {
+			case "True":
+				admitted = true
+			case "False":
+				rejected = append(rejected, fmt.Sprintf("router %v: %v", ingress["routerName"], condition["message"]))
+			}
+		}
+	}
+	return admitted, rejected
+}
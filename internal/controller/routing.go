@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// webhookEndpointSuffix is appended to the name of the Ingress or HTTPRoute serving the webhook endpoint
+const webhookEndpointSuffix = "-webhook"
+
+// n8nEndpoint is a hostname n8n is exposed on, with the path prefixes routed to it
+type n8nEndpoint struct {
+	// name of the Ingress and HTTPRoute exposing the endpoint
+	name             string
+	host             string
+	paths            []string
+	ingressClassName string
+	gatewayRef       *n8nv1alpha1.GatewayRef
+}
+
+// endpointsForN8n returns the endpoints to expose, a single one serving everything unless
+// spec.routing splits the editor and the webhooks
+func endpointsForN8n(n8n *n8nv1alpha1.N8n) []n8nEndpoint {
+	routing := n8n.Spec.Routing
+	if routing == nil {
+		host := ""
+		if n8n.Spec.Hostname != nil && n8n.Spec.Hostname.Enable {
+			host = n8n.Spec.Hostname.Url
+		}
+		return []n8nEndpoint{{name: n8n.Name, host: host, paths: []string{pathForN8n(n8n)}}}
+	}
+
+	webhookPaths := routing.Webhook.Paths
+	if len(webhookPaths) == 0 {
+		webhookPaths = []string{"/webhook", "/webhook-test", "/webhook-waiting"}
+	}
+	return []n8nEndpoint{
+		{
+			name:             n8n.Name,
+			host:             routing.Editor.Hostname,
+			paths:            []string{"/"},
+			ingressClassName: routing.Editor.IngressClassName,
+			gatewayRef:       routing.Editor.GatewayRef,
+		},
+		{
+			name:             n8n.Name + webhookEndpointSuffix,
+			host:             routing.Webhook.Hostname,
+			paths:            webhookPaths,
+			ingressClassName: routing.Webhook.IngressClassName,
+			gatewayRef:       routing.Webhook.GatewayRef,
+		},
+	}
+}
+
+// editorHostForN8n returns the hostname the editor UI is served on
+func editorHostForN8n(n8n *n8nv1alpha1.N8n) string {
+	return endpointsForN8n(n8n)[0].host
+}
+
+// webhookHostForN8n returns the hostname webhooks are served on
+func webhookHostForN8n(n8n *n8nv1alpha1.N8n) string {
+	endpoints := endpointsForN8n(n8n)
+	return endpoints[len(endpoints)-1].host
+}
+
+// pathForN8n returns the sub-path n8n is served under, with leading and trailing slashes
+func pathForN8n(n8n *n8nv1alpha1.N8n) string {
+	if n8n.Spec.Hostname == nil || !n8n.Spec.Hostname.Enable || n8n.Spec.Hostname.Path == "" {
+		return "/"
+	}
+	return "/" + strings.Trim(n8n.Spec.Hostname.Path, "/") + "/"
+}
+
+// n8nURLs describes how n8n is reached from outside the cluster
+type n8nURLs struct {
+	protocol string
+	// port is the public port, zero for the default port of the protocol
+	port        int32
+	path        string
+	editorHost  string
+	webhookHost string
+}
+
+// url returns the public base URL of n8n on the host, or an empty string without a host
+func (u n8nURLs) url(host string) string {
+	if host == "" {
+		return ""
+	}
+	if u.port != 0 && !(u.protocol == "https" && u.port == 443) && !(u.protocol == "http" && u.port == 80) {
+		host = net.JoinHostPort(host, strconv.Itoa(int(u.port)))
+	}
+	return fmt.Sprintf("%s://%s%s", u.protocol, host, u.path)
+}
+
+// urlsForN8n derives the public URLs from how n8n is exposed: whether the Ingress terminates TLS
+// for the editor hostname, or the protocol and port of the Gateway listener the HTTPRoute attaches to
+func (r *N8nReconciler) urlsForN8n(ctx context.Context, n8n *n8nv1alpha1.N8n) (n8nURLs, error) {
+	urls := n8nURLs{
+		protocol:    "https",
+		path:        pathForN8n(n8n),
+		editorHost:  editorHostForN8n(n8n),
+		webhookHost: webhookHostForN8n(n8n),
+	}
+
+	switch {
+	case n8n.Spec.Ingress != nil && n8n.Spec.Ingress.Enable:
+		urls.protocol = "http"
+		for _, tls := range n8n.Spec.Ingress.TLS {
+			if tlsCoversHost(tls, urls.editorHost) {
+				urls.protocol = "https"
+			}
+		}
+	case routeEnabled(n8n):
+		urls.protocol = "http"
+		if routeTermination(n8n) != "" {
+			urls.protocol = "https"
+		}
+	case n8n.Spec.HTTPRoute != nil && n8n.Spec.HTTPRoute.Enable:
+		endpoint := endpointsForN8n(n8n)[0]
+		ref := gatewayRefsForEndpoint(n8n, endpoint)[0]
+
+		gateway := &gatewayv1.Gateway{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, gateway); err != nil {
+			// Without the Gateway assume it terminates TLS on the default port
+			return urls, client.IgnoreNotFound(err)
+		}
+		if listener := listenerForHost(gateway, ref, endpoint.host); listener != nil {
+			urls.port = int32(listener.Port)
+			urls.protocol = "http"
+			if listener.Protocol == gatewayv1.HTTPSProtocolType {
+				urls.protocol = "https"
+			}
+		}
+	}
+	return urls, nil
+}
+
+// listenerForHost returns the Gateway listener the reference may attach to that serves the host,
+// preferring HTTPS
+func listenerForHost(gateway *gatewayv1.Gateway, ref n8nv1alpha1.GatewayRef, host string) *gatewayv1.Listener {
+	var match *gatewayv1.Listener
+	for i := range gateway.Spec.Listeners {
+		listener := &gateway.Spec.Listeners[i]
+		if listener.Protocol != gatewayv1.HTTPProtocolType && listener.Protocol != gatewayv1.HTTPSProtocolType {
+			continue
+		}
+		if ref.SectionName != "" && string(listener.Name) != ref.SectionName {
+			continue
+		}
+		if ref.Port != nil && int32(listener.Port) != *ref.Port {
+			continue
+		}
+		if listener.Hostname != nil && !hostnameMatches(string(*listener.Hostname), host) {
+			continue
+		}
+		if match == nil || listener.Protocol == gatewayv1.HTTPSProtocolType && match.Protocol != gatewayv1.HTTPSProtocolType {
+			match = listener
+		}
+	}
+	return match
+}
+
+// hostnameMatches reports whether a listener hostname, possibly a wildcard, matches the host
+func hostnameMatches(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return pattern == host
+}
@@ -2,50 +2,244 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"time"
 
 	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
-// createPVCIfNotExists creates a PVC for n8n data if it doesn't exist
-func (r *N8nReconciler) createPVCIfNotExists(n8n *n8nv1alpha1.N8n) error {
+const (
+	typeStorageResizingN8n    = "StorageResizing"
+	storageResizePollInterval = 30 * time.Second
+)
+
+func persistentStorageEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.PersistentStorage != nil && n8n.Spec.PersistentStorage.Enable
+}
+
+// managedDataClaim reports whether the operator creates and owns the data PVC
+func managedDataClaim(n8n *n8nv1alpha1.N8n) bool {
+	return persistentStorageEnabled(n8n) &&
+		n8n.Spec.PersistentStorage.ExistingClaim == "" &&
+		n8n.Spec.PersistentStorage.VolumeSource == nil
+}
+
+// sharedStorage reports whether several n8n pods can mount the data volume at the same time. The access
+// modes of a claim that exists are read from it, since the configured ones don't change a claim after creation.
+func (r *N8nReconciler) sharedStorage(ctx context.Context, n8n *n8nv1alpha1.N8n) (bool, error) {
+	if !persistentStorageEnabled(n8n) {
+		return false, nil
+	}
+	claimName := dataClaimName(n8n)
+	if source := n8n.Spec.PersistentStorage.VolumeSource; source != nil {
+		if source.NFS != nil {
+			return true, nil
+		}
+		if source.PersistentVolumeClaim == nil {
+			return false, nil
+		}
+		claimName = source.PersistentVolumeClaim.ClaimName
+	}
+
+	accessModes := n8n.Spec.PersistentStorage.AccessModes
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Name: claimName, Namespace: n8n.Namespace}, pvc)
+	switch {
+	case err == nil && len(pvc.Status.AccessModes) > 0:
+		accessModes = pvc.Status.AccessModes
+	case err == nil:
+		accessModes = pvc.Spec.AccessModes
+	case !apierrors.IsNotFound(err):
+		return false, err
+	}
+	return slices.Contains(accessModes, corev1.ReadWriteMany), nil
+}
+
+// dataClaimName returns the name of the PVC holding the n8n user folder
+func dataClaimName(n8n *n8nv1alpha1.N8n) string {
+	if n8n.Spec.PersistentStorage != nil && n8n.Spec.PersistentStorage.ExistingClaim != "" {
+		return n8n.Spec.PersistentStorage.ExistingClaim
+	}
+	return n8n.Name + "-data"
+}
+
+// dataVolumeSource returns the volume mounted at the n8n user folder
+func dataVolumeSource(n8n *n8nv1alpha1.N8n) corev1.VolumeSource {
+	if n8n.Spec.PersistentStorage.VolumeSource != nil {
+		return *n8n.Spec.PersistentStorage.VolumeSource
+	}
+	return corev1.VolumeSource{
+		PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: dataClaimName(n8n),
+		},
+	}
+}
+
+// syncDataVolume points the data volume of the pod at the configured storage, e.g. after switching to an
+// existing claim, and reports whether it changed
+func syncDataVolume(pod *corev1.PodSpec, desired []corev1.Volume) bool {
+	for _, volume := range desired {
+		if volume.Name != "n8n-data" {
+			continue
+		}
+		for i := range pod.Volumes {
+			// The API server defaults fields of volume sources, only compare the ones set here
+			if pod.Volumes[i].Name == volume.Name && !equality.Semantic.DeepDerivative(volume.VolumeSource, pod.Volumes[i].VolumeSource) {
+				pod.Volumes[i].VolumeSource = volume.VolumeSource
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pvcForN8n returns the PVC for n8n data
+func (r *N8nReconciler) pvcForN8n(n8n *n8nv1alpha1.N8n) (*corev1.PersistentVolumeClaim, error) {
+	storage := n8n.Spec.PersistentStorage
+	size, err := resource.ParseQuantity(storage.Size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid persistent storage size %q: %w", storage.Size, err)
+	}
+
+	accessModes := storage.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      n8n.Name + "-data",
-			Namespace: n8n.Namespace,
+			Name:        dataClaimName(n8n),
+			Namespace:   n8n.Namespace,
+			Labels:      storage.Labels,
+			Annotations: storage.Annotations,
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			AccessModes: accessModes,
+			VolumeMode:  storage.VolumeMode,
+			Selector:    storage.Selector,
 			Resources: corev1.VolumeResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(n8n.Spec.PersistentStorage.Size),
+					corev1.ResourceStorage: size,
 				},
 			},
 		},
 	}
 
-	if n8n.Spec.PersistentStorage.StorageClassName != "" {
-		pvc.Spec.StorageClassName = &n8n.Spec.PersistentStorage.StorageClassName
+	if storage.StorageClassName != "" {
+		pvc.Spec.StorageClassName = &storage.StorageClassName
 	}
 
 	if err := ctrl.SetControllerReference(n8n, pvc, r.Scheme); err != nil {
+		return nil, err
+	}
+	return pvc, nil
+}
+
+// createOrUpdatePVC creates the PVC for n8n data, keeps its labels and annotations in sync and
+// expands it when the requested size grows. The other fields of a claim can't change after creation.
+func (r *N8nReconciler) createOrUpdatePVC(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	if !managedDataClaim(n8n) {
+		return nil
+	}
+
+	pvc, err := r.pvcForN8n(n8n)
+	if err != nil {
 		return err
 	}
+	recordManagedMetadata(pvc)
 
-	existingPvc := &corev1.PersistentVolumeClaim{}
-	err := r.Get(context.TODO(), types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, existingPvc)
-	if err != nil && apierrors.IsNotFound(err) {
-		if err := r.Create(context.TODO(), pvc); err != nil {
+	existing := &corev1.PersistentVolumeClaim{}
+	err = r.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, existing)
+	if apierrors.IsNotFound(err) {
+		return r.Create(ctx, pvc)
+	}
+	if err != nil {
+		return err
+	}
+
+	changed := syncMetadata(existing, pvc)
+
+	desired := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	requested := existing.Spec.Resources.Requests[corev1.ResourceStorage]
+	if desired.Cmp(requested) > 0 {
+		expandable, err := r.storageClassAllowsExpansion(ctx, existing.Spec.StorageClassName)
+		if err != nil {
+			return err
+		}
+		if !expandable {
+			message := fmt.Sprintf("StorageClass of PersistentVolumeClaim %s doesn't allow volume expansion, keeping %s",
+				existing.Name, requested.String())
+			if cond := meta.FindStatusCondition(n8n.Status.Conditions, typeStorageResizingN8n); cond == nil || cond.Message != message {
+				r.Recorder.Event(n8n, "Warning", "ExpansionNotSupported", message)
+			}
+			return r.updateStatus(ctx, n8n, typeStorageResizingN8n, metav1.ConditionFalse, "ExpansionNotSupported", message)
+		}
+		existing.Spec.Resources.Requests[corev1.ResourceStorage] = desired
+		changed = true
+		r.Recorder.Event(n8n, "Normal", "Resizing",
+			fmt.Sprintf("Expanding PersistentVolumeClaim %s from %s to %s", existing.Name, requested.String(), desired.String()))
+	}
+
+	if changed {
+		if err := r.Update(ctx, existing); err != nil {
 			return err
 		}
-	} else if err != nil {
-		return err
 	}
+	return r.reportStorageResize(ctx, n8n, existing)
+}
 
+// reportStorageResize reflects a pending volume expansion in the StorageResizing condition
+func (r *N8nReconciler) reportStorageResize(ctx context.Context, n8n *n8nv1alpha1.N8n, pvc *corev1.PersistentVolumeClaim) error {
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity, bound := pvc.Status.Capacity[corev1.ResourceStorage]
+	if bound && capacity.Cmp(requested) < 0 {
+		return r.updateStatus(ctx, n8n, typeStorageResizingN8n, metav1.ConditionTrue, "Resizing",
+			fmt.Sprintf("Expanding PersistentVolumeClaim %s from %s to %s", pvc.Name, capacity.String(), requested.String()))
+	}
+	if meta.IsStatusConditionTrue(n8n.Status.Conditions, typeStorageResizingN8n) {
+		return r.updateStatus(ctx, n8n, typeStorageResizingN8n, metav1.ConditionFalse, "Resized",
+			fmt.Sprintf("PersistentVolumeClaim %s provides %s", pvc.Name, requested.String()))
+	}
 	return nil
 }
+
+// storageClassAllowsExpansion reports whether volumes of the StorageClass can be expanded
+func (r *N8nReconciler) storageClassAllowsExpansion(ctx context.Context, name *string) (bool, error) {
+	if name == nil || *name == "" {
+		return false, nil
+	}
+	sc := &storagev1.StorageClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: *name}, sc); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion, nil
+}
+
+// mergeStringMap sets the desired entries in target and reports whether it changed
+func mergeStringMap(target *map[string]string, desired map[string]string) bool {
+	changed := false
+	for k, v := range desired {
+		if current, ok := (*target)[k]; ok && current == v {
+			continue
+		}
+		if *target == nil {
+			*target = map[string]string{}
+		}
+		(*target)[k] = v
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	typeSuspendedN8n = "Suspended"
+	typePausedN8n    = "Paused"
+	pausedAnnotation = "n8n.slys.dev/paused"
+	// maintenancePageAnnotation carries a hash of the page on the maintenance pods, so they restart to serve
+	// a changed message right away
+	maintenancePageAnnotation = "n8n.slys.dev/maintenance-page"
+
+	defaultMaintenancePageImage   = "nginxinc/nginx-unprivileged:1.27-alpine"
+	defaultMaintenancePageMessage = "n8n is down for maintenance"
+)
+
+func suspended(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Spec.Suspend
+}
+
+func paused(n8n *n8nv1alpha1.N8n) bool {
+	return n8n.Annotations[pausedAnnotation] == "true"
+}
+
+func maintenancePageEnabled(n8n *n8nv1alpha1.N8n) bool {
+	return suspended(n8n) && n8n.Spec.MaintenancePage != nil && n8n.Spec.MaintenancePage.Enable
+}
+
+func maintenancePageName(n8n *n8nv1alpha1.N8n) string {
+	return n8n.Name + "-maintenance"
+}
+
+func maintenancePageLabels(n8n *n8nv1alpha1.N8n) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       "n8n-maintenance",
+		"app.kubernetes.io/instance":   n8n.Name,
+		"app.kubernetes.io/managed-by": "N8nController",
+	}
+}
+
+// serviceSelectorForN8n returns the pods the Service routes to, the maintenance page replaces n8n while suspended
+func serviceSelectorForN8n(n8n *n8nv1alpha1.N8n) map[string]string {
+	if maintenancePageEnabled(n8n) {
+		return maintenancePageLabels(n8n)
+	}
+	return instanceLabelsForN8n(n8n)
+}
+
+// replicasForN8n returns the replica count the operator sets on the Deployment. n8n runs its triggers
+// on every main instance, so only queue mode workers are scaled beyond one.
+func replicasForN8n(n8n *n8nv1alpha1.N8n) *int32 {
+	if suspended(n8n) {
+		return &[]int32{0}[0]
+	}
+	return &[]int32{1}[0]
+}
+
+// reconcilePause reports whether reconciliation of the child resources is paused and reflects it in the status
+func (r *N8nReconciler) reconcilePause(ctx context.Context, n8n *n8nv1alpha1.N8n) (bool, error) {
+	if paused(n8n) {
+		return true, r.updateStatus(ctx, n8n, typePausedN8n, metav1.ConditionTrue, "Paused",
+			fmt.Sprintf("Reconciliation is paused by the %s annotation", pausedAnnotation))
+	}
+	if meta.IsStatusConditionTrue(n8n.Status.Conditions, typePausedN8n) {
+		return false, r.updateStatus(ctx, n8n, typePausedN8n, metav1.ConditionFalse, "Resumed", "Reconciliation resumed")
+	}
+	return false, nil
+}
+
+// reconcileSuspension scales the n8n Deployment to match spec.suspend and manages the maintenance page
+func (r *N8nReconciler) reconcileSuspension(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: n8n.Name, Namespace: n8n.Namespace}, dep); err != nil {
+		return err
+	}
+
+	replicas := replicasForN8n(n8n)
+	if dep.Spec.Replicas == nil || *dep.Spec.Replicas != *replicas {
+		dep.Spec.Replicas = replicas
+		if err := r.Update(ctx, dep); err != nil {
+			return err
+		}
+	}
+
+	if err := r.reconcileMaintenancePage(ctx, n8n); err != nil {
+		return err
+	}
+
+	if suspended(n8n) {
+		if !meta.IsStatusConditionTrue(n8n.Status.Conditions, typeSuspendedN8n) {
+			r.Recorder.Event(n8n, "Normal", "Suspended", "Scaled n8n to zero")
+		}
+		return r.updateStatus(ctx, n8n, typeSuspendedN8n, metav1.ConditionTrue, "Suspended", "n8n is scaled to zero")
+	}
+	if meta.IsStatusConditionTrue(n8n.Status.Conditions, typeSuspendedN8n) {
+		r.Recorder.Event(n8n, "Normal", "Resumed", "Scaled n8n back up")
+		return r.updateStatus(ctx, n8n, typeSuspendedN8n, metav1.ConditionFalse, "Resumed", "n8n is running")
+	}
+	return nil
+}
+
+// reconcileMaintenancePage runs the maintenance page while it is enabled and removes it otherwise
+func (r *N8nReconciler) reconcileMaintenancePage(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	name := maintenancePageName(n8n)
+	if !maintenancePageEnabled(n8n) {
+		for _, obj := range []client.Object{&appsv1.Deployment{}, &corev1.ConfigMap{}} {
+			if err := r.deleteNamedIfExists(ctx, n8n, obj, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cm, dep, err := r.maintenancePageForN8n(n8n)
+	if err != nil {
+		return err
+	}
+	if err := r.createOrUpdateSpec(ctx, cm, &corev1.ConfigMap{}, func(existing client.Object) bool {
+		current := existing.(*corev1.ConfigMap)
+		if current.Data["index.html"] == cm.Data["index.html"] {
+			return false
+		}
+		current.Data = cm.Data
+		return true
+	}); err != nil {
+		return err
+	}
+	return r.createOrUpdateSpec(ctx, dep, &appsv1.Deployment{}, func(existing client.Object) bool {
+		template := &existing.(*appsv1.Deployment).Spec.Template
+		desired := dep.Spec.Template
+		// The API server defaults fields of the template, only compare the ones set here. Security contexts
+		// are compared in full so that removing settings from the spec removes them from the pods.
+		if len(template.Spec.Containers) == len(desired.Spec.Containers) &&
+			equality.Semantic.DeepDerivative(desired, *template) &&
+			equality.Semantic.DeepEqual(desired.Spec.SecurityContext, template.Spec.SecurityContext) &&
+			equality.Semantic.DeepEqual(desired.Spec.Containers[0].SecurityContext, template.Spec.Containers[0].SecurityContext) {
+			return false
+		}
+		*template = desired
+		return true
+	})
+}
+
+// maintenancePageForN8n builds the ConfigMap holding the maintenance page and the Deployment serving it
+func (r *N8nReconciler) maintenancePageForN8n(n8n *n8nv1alpha1.N8n) (*corev1.ConfigMap, *appsv1.Deployment, error) {
+	page := n8n.Spec.MaintenancePage
+	image := page.Image
+	if image == "" {
+		image = defaultMaintenancePageImage
+	}
+	message := page.Message
+	if message == "" {
+		message = defaultMaintenancePageMessage
+	}
+
+	name := maintenancePageName(n8n)
+	ls := maintenancePageLabels(n8n)
+	index := fmt.Sprintf("<!DOCTYPE html>\n<html><head><title>Maintenance</title></head><body><h1>%s</h1></body></html>\n",
+		html.EscapeString(message))
+	indexHash := sha256.Sum256([]byte(index))
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: n8n.Namespace,
+			Labels:    ls,
+		},
+		Data: map[string]string{
+			"index.html": index,
+		},
+	}
+
+	volumes := []corev1.Volume{{
+		Name: "page",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			},
+		},
+	}}
+	volumeMounts := []corev1.VolumeMount{{
+		Name:      "page",
+		MountPath: "/usr/share/nginx/html",
+		ReadOnly:  true,
+	}}
+	writable, writableMounts := writableVolumes(n8n, map[string]string{"tmp": "/tmp"})
+	volumes = append(volumes, writable...)
+	volumeMounts = append(volumeMounts, writableMounts...)
+
+	replicas := int32(1)
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: n8n.Namespace,
+			Labels:    ls,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: ls,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: ls,
+					Annotations: map[string]string{
+						maintenancePageAnnotation: hex.EncodeToString(indexHash[:]),
+					},
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: getPodSecurityContext(n8n),
+					Volumes:         volumes,
+					Containers: []corev1.Container{{
+						Name:            "maintenance",
+						Image:           image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						SecurityContext: getContainerSecurityContext(n8n),
+						Ports: []corev1.ContainerPort{{
+							ContainerPort: 8080,
+							Name:          "http",
+						}},
+						VolumeMounts: volumeMounts,
+					}},
+				},
+			},
+		},
+	}
+
+	if err := ctrl.SetControllerReference(n8n, cm, r.Scheme); err != nil {
+		return nil, nil, err
+	}
+	if err := ctrl.SetControllerReference(n8n, dep, r.Scheme); err != nil {
+		return nil, nil, err
+	}
+	return cm, dep, nil
+}
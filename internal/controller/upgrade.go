@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	typeUpgradeInProgressN8n = "UpgradeInProgress"
+	typeUpgradeFailedN8n     = "UpgradeFailed"
+	typeUpgradeAvailableN8n  = "UpgradeAvailable"
+	rollbackAnnotation       = "n8n.slys.dev/rollback"
+	upgradePollInterval      = 10 * time.Second
+)
+
+// desiredVersionForN8n returns the n8n version the instance should run. Without an explicit version,
+// the release shipped with the operator is followed as far as the upgrade policy allows.
+func desiredVersionForN8n(n8n *n8nv1alpha1.N8n) string {
+	if n8n.Spec.Version != "" {
+		return n8n.Spec.Version
+	}
+	current := n8n.Status.Version
+	if current == "" || current == n8nVersion || upgradePolicyAllows(n8n.Spec.UpgradePolicy, current, n8nVersion) {
+		return n8nVersion
+	}
+	return current
+}
+
+// pendingVersionForN8n returns the operator-shipped release held back by the upgrade policy, if any
+func pendingVersionForN8n(n8n *n8nv1alpha1.N8n) string {
+	if n8n.Spec.Version != "" || n8n.Status.Version == "" {
+		return ""
+	}
+	current, ok := parseN8nVersion(n8n.Status.Version)
+	if !ok {
+		return ""
+	}
+	shipped, ok := parseN8nVersion(n8nVersion)
+	if !ok || !current.less(shipped) || desiredVersionForN8n(n8n) == n8nVersion {
+		return ""
+	}
+	return n8nVersion
+}
+
+// imageVersionForN8n returns the n8n version a newly created Deployment runs. Once a version
+// is rolled out, moving to another one goes through the upgrade workflow instead.
+func imageVersionForN8n(n8n *n8nv1alpha1.N8n) string {
+	if n8n.Status.Version != "" {
+		return n8n.Status.Version
+	}
+	return desiredVersionForN8n(n8n)
+}
+
+// upgrading reports whether a version rollout, including the backup taken before it, is in progress
+func upgrading(n8n *n8nv1alpha1.N8n) bool {
+	return meta.IsStatusConditionTrue(n8n.Status.Conditions, typeUpgradeInProgressN8n)
+}
+
+// n8nContainer returns the n8n container of the Deployment
+func n8nContainer(dep *appsv1.Deployment) *corev1.Container {
+	for i := range dep.Spec.Template.Spec.Containers {
+		if dep.Spec.Template.Spec.Containers[i].Name == "n8n" {
+			return &dep.Spec.Template.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+// deploymentRolledOut reports whether every replica runs the current pod template
+func deploymentRolledOut(dep *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+	return dep.Status.ObservedGeneration >= dep.Generation &&
+		dep.Status.UpdatedReplicas == replicas &&
+		dep.Status.Replicas == replicas &&
+		dep.Status.AvailableReplicas == replicas
+}
+
+// deploymentRolloutFailed reports whether the Deployment gave up progressing
+func deploymentRolloutFailed(dep *appsv1.Deployment) bool {
+	for _, c := range dep.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse && c.Reason == "ProgressDeadlineExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileUpgrade rolls the Deployment to the desired n8n version, taking a database backup first when configured
+func (r *N8nReconciler) reconcileUpgrade(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	log := log.FromContext(ctx)
+
+	dep := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: n8n.Name, Namespace: n8n.Namespace}, dep); err != nil {
+		return err
+	}
+	container := n8nContainer(dep)
+	if container == nil {
+		return fmt.Errorf("deployment %s has no n8n container", dep.Name)
+	}
+	running := versionOfImage(container.Image)
+
+	// Adopt the version of Deployments created before the operator tracked it
+	if n8n.Status.Version == "" {
+		n8n.Status.Version = running
+		if err := r.Status().Update(ctx, n8n); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := n8n.Annotations[rollbackAnnotation]; ok {
+		if err := r.requestRollback(ctx, n8n); err != nil {
+			return err
+		}
+	}
+
+	if err := r.reportPendingUpgrade(ctx, n8n); err != nil {
+		return err
+	}
+
+	// Version changes wait until the instance is resumed
+	if suspended(n8n) {
+		return nil
+	}
+
+	target := desiredVersionForN8n(n8n)
+	if running != target {
+		rollingBack := n8n.Status.PreviousVersion != "" && target == n8n.Status.PreviousVersion
+
+		warning, err := checkVersionChange(n8n.Status.Version, target, rollingBack)
+		if err != nil {
+			return r.refuseUpgrade(ctx, n8n, err.Error())
+		}
+
+		if !rollingBack && n8n.Spec.Upgrade != nil && n8n.Spec.Upgrade.Backup {
+			done, err := r.backupBeforeUpgrade(ctx, n8n, target)
+			if err != nil || !done {
+				return err
+			}
+		}
+
+		reason := "Upgrading"
+		if rollingBack {
+			reason = "RollingBack"
+			n8n.Status.PreviousVersion = ""
+		} else {
+			n8n.Status.PreviousVersion = n8n.Status.Version
+		}
+
+		if warning != "" {
+			r.Recorder.Event(n8n, "Warning", "UpgradeWarning", warning)
+		}
+		log.Info("Rolling out n8n version", "from", running, "to", target)
+		container.Image = n8nImage(target)
+		// The old version must not keep running against the database while the new one migrates it,
+		// the workers are stopped for the same reason until the rollout completes
+		dep.Spec.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+		if err := r.Update(ctx, dep); err != nil {
+			return err
+		}
+		r.Recorder.Event(n8n, "Normal", reason, fmt.Sprintf("Rolling out n8n %s, replacing %s", target, running))
+		return r.updateStatus(ctx, n8n, typeUpgradeInProgressN8n, metav1.ConditionTrue, reason,
+			fmt.Sprintf("Rolling out n8n %s, replacing %s", target, running))
+	}
+
+	inProgress := meta.FindStatusCondition(n8n.Status.Conditions, typeUpgradeInProgressN8n)
+	if inProgress == nil || inProgress.Status != metav1.ConditionTrue {
+		if n8n.Status.Version != running {
+			n8n.Status.Version = running
+			return r.Status().Update(ctx, n8n)
+		}
+		return nil
+	}
+
+	if deploymentRolloutFailed(dep) {
+		meta.SetStatusCondition(&n8n.Status.Conditions, metav1.Condition{
+			Type:               typeUpgradeInProgressN8n,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: n8n.Generation,
+			Reason:             "Failed",
+			Message:            fmt.Sprintf("Rollout of n8n %s failed", target),
+		})
+		message := fmt.Sprintf("Rollout of n8n %s did not become ready", target)
+		if n8n.Status.PreviousVersion != "" {
+			message += fmt.Sprintf(", annotate the resource with %s to roll back to %s", rollbackAnnotation, n8n.Status.PreviousVersion)
+		}
+		r.Recorder.Event(n8n, "Warning", "UpgradeFailed", message)
+		return r.updateStatus(ctx, n8n, typeUpgradeFailedN8n, metav1.ConditionTrue, "RolloutFailed", message)
+	}
+
+	if !deploymentRolledOut(dep) {
+		return nil
+	}
+	if dep.Spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		dep.Spec.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}
+		if err := r.Update(ctx, dep); err != nil {
+			return err
+		}
+	}
+
+	rolledBack := inProgress.Reason == "RollingBack"
+	n8n.Status.Version = target
+	meta.SetStatusCondition(&n8n.Status.Conditions, metav1.Condition{
+		Type:               typeUpgradeInProgressN8n,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: n8n.Generation,
+		Reason:             "Completed",
+		Message:            fmt.Sprintf("n8n %s rolled out", target),
+	})
+	if rolledBack {
+		return r.updateStatus(ctx, n8n, typeUpgradeFailedN8n, metav1.ConditionTrue, "RolledBack",
+			fmt.Sprintf("Rolled back to n8n %s", target))
+	}
+	return r.updateStatus(ctx, n8n, typeUpgradeFailedN8n, metav1.ConditionFalse, "Completed",
+		fmt.Sprintf("Upgraded to n8n %s", target))
+}
+
+// requestRollback pins the desired version to the one that ran before the last upgrade
+func (r *N8nReconciler) requestRollback(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	previous := n8n.Status.PreviousVersion
+	delete(n8n.Annotations, rollbackAnnotation)
+	if previous == "" {
+		r.Recorder.Event(n8n, "Warning", "RollbackUnavailable", "No previous n8n version is known, ignoring the rollback request")
+	} else {
+		n8n.Spec.Version = previous
+		r.Recorder.Event(n8n, "Normal", "RollbackRequested", fmt.Sprintf("Rolling back to n8n %s", previous))
+	}
+
+	status := n8n.Status.DeepCopy()
+	if err := r.Update(ctx, n8n); err != nil {
+		return err
+	}
+	// Update returns the stored object, keep the status computed during this reconciliation
+	n8n.Status = *status
+	return nil
+}
+
+// backupBeforeUpgrade runs the pre-upgrade backup Job and reports whether it succeeded. The succeeded
+// Job is removed, so a later attempt at the same version, e.g. after a rollback, backs up again.
+func (r *N8nReconciler) backupBeforeUpgrade(ctx context.Context, n8n *n8nv1alpha1.N8n, target string) (bool, error) {
+	name := fmt.Sprintf("%s-upgrade-%s", n8n.Name, strings.ReplaceAll(target, ".", "-"))
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: n8n.Namespace}, job)
+	if apierrors.IsNotFound(err) {
+		job, err = r.backupJobForN8n(n8n, name, "pre-"+target)
+		if err != nil {
+			return false, err
+		}
+		if err := r.Create(ctx, job); err != nil {
+			return false, err
+		}
+		return false, r.updateStatus(ctx, n8n, typeUpgradeInProgressN8n, metav1.ConditionTrue, "BackingUp",
+			fmt.Sprintf("Backing up the database before upgrading to n8n %s", target))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	finished, succeeded := jobFinished(job)
+	switch {
+	case !finished:
+		return false, nil
+	case !succeeded:
+		message := fmt.Sprintf("Backup Job %s failed, delete it to retry the upgrade to n8n %s", name, target)
+		r.Recorder.Event(n8n, "Warning", "UpgradeFailed", message)
+		meta.SetStatusCondition(&n8n.Status.Conditions, metav1.Condition{
+			Type:               typeUpgradeInProgressN8n,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: n8n.Generation,
+			Reason:             "Failed",
+			Message:            message,
+		})
+		return false, r.updateStatus(ctx, n8n, typeUpgradeFailedN8n, metav1.ConditionTrue, "BackupFailed", message)
+	}
+	if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// refuseUpgrade reports a version change that is not rolled out
+func (r *N8nReconciler) refuseUpgrade(ctx context.Context, n8n *n8nv1alpha1.N8n, message string) error {
+	cond := meta.FindStatusCondition(n8n.Status.Conditions, typeUpgradeFailedN8n)
+	if cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason == "UnsupportedUpgrade" && cond.Message == message {
+		return nil
+	}
+	r.Recorder.Event(n8n, "Warning", "UnsupportedUpgrade", message)
+	return r.updateStatus(ctx, n8n, typeUpgradeFailedN8n, metav1.ConditionTrue, "UnsupportedUpgrade", message)
+}
+
+// reportPendingUpgrade tells whether an operator-shipped release awaits approval
+func (r *N8nReconciler) reportPendingUpgrade(ctx context.Context, n8n *n8nv1alpha1.N8n) error {
+	pending := pendingVersionForN8n(n8n)
+	cond := meta.FindStatusCondition(n8n.Status.Conditions, typeUpgradeAvailableN8n)
+	if pending == "" {
+		if cond == nil || cond.Status == metav1.ConditionFalse {
+			return nil
+		}
+		return r.updateStatus(ctx, n8n, typeUpgradeAvailableN8n, metav1.ConditionFalse, "UpToDate",
+			"No upgrade awaits approval")
+	}
+
+	message := fmt.Sprintf("n8n %s is available, set spec.version to approve the upgrade from %s", pending, n8n.Status.Version)
+	if cond != nil && cond.Status == metav1.ConditionTrue && cond.Message == message {
+		return nil
+	}
+	r.Recorder.Event(n8n, "Normal", "UpgradeAvailable", message)
+	return r.updateStatus(ctx, n8n, typeUpgradeAvailableN8n, metav1.ConditionTrue, "AwaitingApproval", message)
+}
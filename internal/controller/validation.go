@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	n8nv1alpha1 "github.com/jakub-k-slys/n8n-operator/api/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+const reasonInvalidConfiguration = "InvalidConfiguration"
+
+// validateN8n checks constraints spanning several parts of the spec that cannot be expressed at admission.
+// sharedStorage tells whether the data volume can be mounted by several pods, which depends on the claim.
+func validateN8n(n8n *n8nv1alpha1.N8n, sharedStorage bool) error {
+	validators := []func(*n8nv1alpha1.N8n) error{
+		func(n8n *n8nv1alpha1.N8n) error { return validateBinaryData(n8n, sharedStorage) },
+		validateExposure,
+	}
+	for _, validate := range validators {
+		if err := validate(n8n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateExposure checks that an exposed instance has the hostname its URLs are built from and a
+// single path they share
+func validateExposure(n8n *n8nv1alpha1.N8n) error {
+	exposed := (n8n.Spec.Ingress != nil && n8n.Spec.Ingress.Enable) || (n8n.Spec.HTTPRoute != nil && n8n.Spec.HTTPRoute.Enable) ||
+		routeEnabled(n8n)
+	if exposed && editorHostForN8n(n8n) == "" {
+		return errors.New("ingress, httpRoute and route require hostname.url or routing")
+	}
+	// The endpoints of routing are served from the root, a sub-path would only apply to some of the URLs
+	if n8n.Spec.Routing != nil && n8n.Spec.Hostname != nil && strings.Trim(n8n.Spec.Hostname.Path, "/") != "" {
+		return errors.New("routing serves n8n from the root path, remove hostname.path")
+	}
+	if routeEnabled(n8n) && routeTermination(n8n) == n8nv1alpha1.RouteTerminationPassthrough && pathForN8n(n8n) != "/" {
+		return errors.New("passthrough Routes can't route a sub-path, remove hostname.path or terminate TLS at the router")
+	}
+	return validateIngressPath(n8n)
+}
+
+// validateIngressPath refuses an Ingress path that doesn't route the path n8n serves under, which is
+// taken from hostname.path. Implementation specific paths, e.g. regular expressions, must start with it.
+func validateIngressPath(n8n *n8nv1alpha1.N8n) error {
+	config := n8n.Spec.Ingress
+	if config == nil || !config.Enable || config.Path == "" {
+		return nil
+	}
+	n8nPath := pathForN8n(n8n)
+	if config.PathType == string(networkingv1.PathTypeImplementationSpecific) {
+		if !strings.HasPrefix(config.Path, strings.TrimSuffix(n8nPath, "/")) {
+			return fmt.Errorf("ingress.path %s must start with the n8n path %s, set hostname.path to change it", config.Path, n8nPath)
+		}
+		return nil
+	}
+	if strings.TrimSuffix(config.Path, "/")+"/" != n8nPath {
+		return fmt.Errorf("ingress.path %s differs from the n8n path %s, set hostname.path to change it", config.Path, n8nPath)
+	}
+	return nil
+}